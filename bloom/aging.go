@@ -0,0 +1,170 @@
+package bloom
+
+import (
+	"fmt"
+	"hash"
+	"math"
+	"sync"
+	"time"
+)
+
+// check interface implementation
+var _ Filter = &agingFilter{}
+
+// agingFilter is a ring of double hashing filters, one by generation. Objects are added to the current
+// generation and looked up in all of them, rotating drop the oldest generation at once so objects expire
+// after between generations-1 and generations intervals without the filter ever growing.
+type agingFilter struct {
+	mu     sync.RWMutex
+	hash   hash.Hash
+	hashID uint64
+	// generations is a ring, head is the current generation and head+1 the oldest.
+	generations []*filter
+	head        int
+	// interval between rotations, 0 when only rotated by Rotate.
+	interval time.Duration
+	// next is the end of the current generation.
+	next time.Time
+	now  func() time.Time
+}
+
+// NewAgePartitioned create a filter remembering objects of the last generations intervals,
+// each generation is sized for n objects and the false positive rate of all generations stay under fpRate.
+// With a 0 interval generations are only rotated by calls to Rotate. Without hash a 128 bits murmur3 is used.
+//
+// To remember at least 30 days with a daily interval use 31 generations.
+func NewAgePartitioned(n uint64, fpRate float64, generations int, interval time.Duration, hashList ...hash.Hash) (*agingFilter, error) {
+	if generations < 1 || interval < 0 || !(fpRate > 0 && fpRate < 1) {
+		return nil, fmt.Errorf("%w: generations=%d interval=%s fpRate=%f", ErrInvalidEstimates, generations, interval, fpRate)
+	}
+	// an object is a false positive if any generation report it
+	subRate := 1 - math.Pow(1-fpRate, 1/float64(generations))
+	hash, m, k, err := estimate(strategyDoubleHashing, n, subRate, hashList...)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &agingFilter{
+		hash:        hash,
+		hashID:      HashID(hash),
+		generations: make([]*filter, generations),
+		interval:    interval,
+		now:         time.Now,
+	}
+	for i := range f.generations {
+		f.generations[i] = newFilter(hash, strategyDoubleHashing, m, k)
+	}
+	f.next = f.now().Add(interval)
+
+	return f, nil
+}
+
+func (f *agingFilter) hashBytes(b []byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hash.Write(b)
+	fp := f.hash.Sum(nil)
+	f.hash.Reset()
+
+	return fp
+}
+
+// Rotate start a new generation, dropping the objects of the oldest one.
+func (f *agingFilter) Rotate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rotate()
+}
+
+func (f *agingFilter) rotate() {
+	f.head = (f.head + 1) % len(f.generations)
+	f.generations[f.head].reset()
+}
+
+// expire rotate generations whose interval is over.
+func (f *agingFilter) expire() {
+	if f.interval == 0 {
+		return
+	}
+
+	now := f.now()
+	f.mu.RLock()
+	due := !now.Before(f.next)
+	f.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// at most one full turn, after a longer idle period all generations are empty anyway
+	for i := 0; i < len(f.generations) && !now.Before(f.next); i++ {
+		f.rotate()
+		f.next = f.next.Add(f.interval)
+	}
+	if !now.Before(f.next) {
+		f.next = f.next.Add((now.Sub(f.next)/f.interval + 1) * f.interval)
+	}
+}
+
+func (f *agingFilter) Add(b []byte) {
+	f.AddFingerprint(f.hashBytes(b))
+}
+
+// AddFingerprint add fingerprint to the current generation.
+func (f *agingFilter) AddFingerprint(fp []byte) {
+	f.expire()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	f.generations[f.head].AddFingerprint(fp)
+}
+
+func (f *agingFilter) Contain(b []byte) bool {
+	return f.ContainFingerprint(f.hashBytes(b))
+}
+
+func (f *agingFilter) ContainFingerprint(fp []byte) bool {
+	f.expire()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	// most recent generations first
+	for i := 0; i < len(f.generations); i++ {
+		g := (f.head - i + len(f.generations)) % len(f.generations)
+		if f.generations[g].ContainFingerprint(fp) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ByteSize return the memory used by all generations bits.
+func (f *agingFilter) ByteSize() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var size uint64
+	for _, g := range f.generations {
+		size += g.ByteSize()
+	}
+
+	return size
+}
+
+// reset clear all objects of the filter.
+func (f *filter) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.fingerprint {
+		f.fingerprint[i] = 0
+	}
+	f.count = 0
+}
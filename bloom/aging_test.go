@@ -0,0 +1,120 @@
+package bloom_test
+
+import (
+	"bloom"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countContained return the number of urls from..to contained in filter.
+func countContained(filter bloom.Filter, from, to int) int {
+	contained := 0
+	for i := from; i < to; i++ {
+		if filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))) {
+			contained++
+		}
+	}
+	return contained
+}
+
+func TestAgePartitionedFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		generations int
+		fpRate      float64
+	}{
+		{
+			name:        "1 generation",
+			generations: 1,
+			fpRate:      0.01,
+		},
+		{
+			name:        "3 generations",
+			generations: 3,
+			fpRate:      0.01,
+		},
+		{
+			name:        "31 generations",
+			generations: 31,
+			fpRate:      0.01,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := 1000
+			filter, err := bloom.NewAgePartitioned(uint64(n), tt.fpRate, tt.generations, 0)
+			require.NoError(t, err)
+
+			// fill all generations, each with different objects
+			for g := 0; g < tt.generations; g++ {
+				if g > 0 {
+					filter.Rotate()
+				}
+				for i := g * n; i < (g+1)*n; i++ {
+					filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+				}
+			}
+			all := tt.generations * n
+			require.Equal(t, all, countContained(filter, 0, all), "false negative")
+
+			falsePositive := countContained(filter, all, 2*all)
+			// generations are sized for exactly fpRate, allow some statistical noise
+			assert.Less(t, float64(falsePositive)/float64(all), tt.fpRate*1.2, "false positive rate")
+
+			// the oldest generation expire whole
+			filter.Rotate()
+			assert.LessOrEqual(t, countContained(filter, 0, n), int(float64(n)*tt.fpRate)+1, "expired")
+			require.Equal(t, all-n, countContained(filter, n, all), "false negative after rotation")
+		})
+	}
+}
+
+func TestAgePartitionedFilterInterval(t *testing.T) {
+	filter, err := bloom.NewAgePartitioned(1000, 0.01, 30, 24*time.Hour)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	bloom.SetClock(filter, func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	url := []byte("https://example.com/visited")
+	filter.Add(url)
+
+	advance(29 * 24 * time.Hour)
+	assert.True(t, filter.Contain(url), "visited in the last 30 days")
+
+	advance(24 * time.Hour)
+	assert.False(t, filter.Contain(url), "expired after 30 days")
+
+	// after a long idle period everything is expired and the current generation is usable
+	filter.Add(url)
+	advance(365 * 24 * time.Hour)
+	assert.False(t, filter.Contain(url), "expired after idle period")
+	filter.Add(url)
+	advance(23 * time.Hour)
+	assert.True(t, filter.Contain(url), "added after idle period")
+}
+
+func TestAgePartitionedFilterInvalid(t *testing.T) {
+	_, err := bloom.NewAgePartitioned(1000, 0.01, 0, time.Hour)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+	_, err = bloom.NewAgePartitioned(1000, 0.01, 3, -time.Hour)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+	_, err = bloom.NewAgePartitioned(0, 0.01, 3, time.Hour)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+}
@@ -0,0 +1,160 @@
+package bloom
+
+import "sync"
+
+// check interface implementation
+var _ BatchFilter = &filter{}
+
+// BatchFilter is a Filter adding and looking up many objects at once, locking once by batch.
+type BatchFilter interface {
+	Filter
+	// AddMany add all objects to the filter.
+	AddMany(objects [][]byte)
+	// ContainMany append to dst if each object is probably in the filter.
+	ContainMany(dst []bool, objects [][]byte) []bool
+}
+
+// AddMany add all objects to f, in a single batch if f is a BatchFilter.
+func AddMany(f Filter, objects [][]byte) {
+	if bf, ok := f.(BatchFilter); ok {
+		bf.AddMany(objects)
+		return
+	}
+
+	for _, o := range objects {
+		f.Add(o)
+	}
+}
+
+// ContainMany append to dst if each object is probably in f, in a single batch if f is a BatchFilter.
+func ContainMany(f Filter, dst []bool, objects [][]byte) []bool {
+	if bf, ok := f.(BatchFilter); ok {
+		return bf.ContainMany(dst, objects)
+	}
+
+	for _, o := range objects {
+		dst = append(dst, f.Contain(o))
+	}
+	return dst
+}
+
+// batchBuffers are reused between batches.
+type batchBuffers struct {
+	sums      []byte
+	positions []uint64
+}
+
+var batchPool = sync.Pool{
+	New: func() any { return &batchBuffers{} },
+}
+
+// sumMany append to sums the hash results of all objects, each of size f.hash.Size().
+func (f *filter) sumMany(sums []byte, objects [][]byte) []byte {
+	if f.murmur {
+		for _, o := range objects {
+			fp := BytesHasher{}.Fingerprint(o)
+			sums = append(sums, fp[:]...)
+		}
+		return sums
+	}
+
+	h, hash := f.getHash()
+	for _, o := range objects {
+		hash.Write(o)
+		sums = hash.Sum(sums)
+		hash.Reset()
+	}
+	f.releaseHash(h)
+	f.hashers.Put(h)
+
+	return sums
+}
+
+// positionsMany append to positions the k positions of each hash result of sums, object i positions are [i*k, (i+1)*k).
+// f.mu should be held.
+func (f *filter) positionsMany(positions []uint64, sums []byte, n int) []uint64 {
+	size := len(sums) / n
+	for i := 0; i < n; i++ {
+		positions = f.strategy.positions(positions, sums[i*size:(i+1)*size], f.m, f.k)
+	}
+	return positions
+}
+
+// AddMany hash all objects outside the filter lock then compute and set their bits under a single lock,
+// positions depend on the size of the filter changed by ReadFrom.
+// Positions are set in object order: sorting them first to set the bits of each filter region together
+// was measured 7 to 12 times slower, even on filters far larger than CPU caches, as a batch touch a few bits
+// of each region at most.
+func (f *filter) AddMany(objects [][]byte) {
+	if len(objects) == 0 {
+		return
+	}
+	buf := batchPool.Get().(*batchBuffers)
+	defer batchPool.Put(buf)
+	buf.sums = f.sumMany(buf.sums[:0], objects)
+	sums := buf.sums
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.count += uint64(len(objects))
+	if f.strategy == strategyDigest {
+		size := len(sums) / len(objects)
+		for i := range objects {
+			orBytes(f.fingerprint, sums[i*size:(i+1)*size])
+		}
+		return
+	}
+
+	buf.positions = f.positionsMany(buf.positions[:0], sums, len(objects))
+	for _, pos := range buf.positions {
+		f.fingerprint[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+// ContainMany hash all objects outside the filter lock then compute and test their bits under a single read lock.
+func (f *filter) ContainMany(dst []bool, objects [][]byte) []bool {
+	if len(objects) == 0 {
+		return dst
+	}
+	buf := batchPool.Get().(*batchBuffers)
+	defer batchPool.Put(buf)
+	buf.sums = f.sumMany(buf.sums[:0], objects)
+	sums := buf.sums
+
+	start := len(dst)
+	for range objects {
+		dst = append(dst, true)
+	}
+	results := dst[start:]
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.strategy == strategyDigest {
+		size := len(sums) / len(objects)
+		for i := range objects {
+			for j, v := range f.fingerprint {
+				if v|sums[i*size+j] != v {
+					results[i] = false
+					break
+				}
+			}
+		}
+		return dst
+	}
+
+	buf.positions = f.positionsMany(buf.positions[:0], sums, len(objects))
+	positions := buf.positions
+	k := int(f.k)
+	for i := range results {
+		for _, pos := range positions[i*k : (i+1)*k] {
+			if f.fingerprint[pos/8]&(1<<(pos%8)) == 0 {
+				results[i] = false
+				break
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,180 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchFilter(t *testing.T) {
+	n := 10000
+	tests := []struct {
+		name      string
+		newFilter func() (bloom.Filter, error)
+	}{
+		{
+			name: "MD5",
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.New(crypto.MD5.New())
+			},
+		},
+		{
+			name: "SHA512-Estimates",
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewWithEstimates(uint64(n), 0.01, crypto.SHA512.New())
+			},
+		},
+		{
+			name: "Murmur3_128-DoubleHashing",
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(uint64(n), 0.01)
+			},
+		},
+		{
+			name: "Murmur3_128-DoubleHashing-Large", // larger than CPU caches
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(uint64(100*n), 0.001)
+			},
+		},
+		{
+			name: "MD5-Blocked",
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewBlocked(uint64(n), 0.01, crypto.MD5.New())
+			},
+		},
+		{
+			name: "Counting", // not a BatchFilter
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewCounting(uint64(n), 0.01)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			batch, err := tt.newFilter()
+			require.NoError(t, err)
+			single, err := tt.newFilter()
+			require.NoError(t, err)
+
+			objects := make([][]byte, 0, 2*n)
+			for i := 0; i < 2*n; i++ {
+				objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			bloom.AddMany(batch, objects[:n])
+			for _, o := range objects[:n] {
+				single.Add(o)
+			}
+
+			// keep the existing content of dst
+			contained := bloom.ContainMany(batch, []bool{false}, objects)
+			require.Len(t, contained, 2*n+1)
+			assert.False(t, contained[0])
+			for i, o := range objects {
+				require.Equal(t, single.Contain(o), contained[i+1], "object %d", i)
+				require.Equal(t, batch.Contain(o), contained[i+1], "object %d", i)
+			}
+
+			if bf, ok := batch.(binaryFilter); ok {
+				data, err := bf.MarshalBinary()
+				require.NoError(t, err)
+				data2, err := single.(binaryFilter).MarshalBinary()
+				require.NoError(t, err)
+				assert.Equal(t, data2, data, "same filter as single adds")
+			}
+
+			assert.Empty(t, bloom.ContainMany(batch, nil, nil))
+		})
+	}
+}
+
+func TestBatchFilterReload(t *testing.T) {
+	small, err := bloom.NewDoubleHashing(100, 0.01)
+	require.NoError(t, err)
+	large, err := bloom.NewDoubleHashing(20000, 0.01)
+	require.NoError(t, err)
+	smallData, err := small.MarshalBinary()
+	require.NoError(t, err)
+	largeData, err := large.MarshalBinary()
+	require.NoError(t, err)
+
+	objects := make([][]byte, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+
+	// the size of the filter can change while a batch is hashed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			assert.NoError(t, small.UnmarshalBinary(largeData))
+			assert.NoError(t, small.UnmarshalBinary(smallData))
+		}
+	}()
+	var contained []bool
+	for i := 0; i < 200; i++ {
+		bloom.AddMany(small, objects)
+		contained = bloom.ContainMany(small, contained[:0], objects)
+	}
+	<-done
+}
+
+func BenchmarkBatchFilter(b *testing.B) {
+	batchSize := 4096
+	for _, n := range []uint64{100000, 10000000} {
+		n := n
+		objects := make([][]byte, 0, 256*batchSize) // more than the CPU caches
+		for i := 0; i < cap(objects); i++ {
+			objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+		}
+		batch := func(i int) [][]byte {
+			start := i * batchSize % len(objects)
+			return objects[start : start+batchSize]
+		}
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			filter, err := bloom.NewDoubleHashing(n, 0.01)
+			require.NoError(b, err)
+
+			b.Run("Add", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					for _, o := range batch(i) {
+						filter.Add(o)
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/object")
+			})
+			b.Run("AddMany", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					filter.AddMany(batch(i))
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/object")
+			})
+			// half of objects are in the filter
+			filter, err = bloom.NewDoubleHashing(n, 0.01)
+			require.NoError(b, err)
+			filter.AddMany(objects[:len(objects)/2])
+
+			b.Run("Contain", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					for _, o := range batch(i) {
+						filter.Contain(o)
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/object")
+			})
+			b.Run("ContainMany", func(b *testing.B) {
+				contained := make([]bool, 0, batchSize)
+				for i := 0; i < b.N; i++ {
+					contained = filter.ContainMany(contained[:0], batch(i))
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/object")
+			})
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package bloom_test
+
+import (
+	"bloom"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockedFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          uint64
+		fpRate     float64
+		maxPenalty float64 // measured rate over fpRate
+	}{
+		{
+			name:       "1%",
+			n:          100000,
+			fpRate:     0.01,
+			maxPenalty: 1.4,
+		},
+		{
+			name:       "0.1%",
+			n:          100000,
+			fpRate:     0.001,
+			maxPenalty: 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := bloom.NewBlocked(tt.n, tt.fpRate)
+			require.NoError(t, err)
+			assert.Zero(t, filter.Stats().Bits%512, "whole blocks")
+
+			for i := uint64(0); i < tt.n; i++ {
+				filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			for i := uint64(0); i < tt.n; i++ {
+				require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+
+			falsePositive := 0
+			probes := 10 * tt.n
+			for i := tt.n; i < tt.n+probes; i++ {
+				if filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))) {
+					falsePositive++
+				}
+			}
+			rate := float64(falsePositive) / float64(probes)
+			t.Logf("false positive rate %.4f%% for %.4f%%", 100*rate, 100*tt.fpRate)
+			assert.Less(t, rate, tt.fpRate*tt.maxPenalty, "false positive rate")
+
+			data, err := filter.MarshalBinary()
+			require.NoError(t, err)
+			filter2, err := bloom.NewBlocked(tt.n, tt.fpRate)
+			require.NoError(t, err)
+			require.NoError(t, filter2.UnmarshalBinary(data))
+			assert.True(t, filter2.Contain([]byte("https://example.com/0")))
+		})
+	}
+}
+
+func BenchmarkBlockedFilter(b *testing.B) {
+	for _, n := range []int{1000000, 10000000} {
+		n := n
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for name, newFilter := range map[string]func() (stringFilter, error){
+				"Blocked": func() (stringFilter, error) {
+					return bloom.NewBlocked(uint64(n), 0.01)
+				},
+				"DoubleHashing": func() (stringFilter, error) {
+					return bloom.NewDoubleHashing(uint64(n), 0.01)
+				},
+			} {
+				newFilter := newFilter
+				b.Run(name, func(b *testing.B) {
+					filter, err := newFilter()
+					require.NoError(b, err)
+
+					url := []byte("https://example.com/")
+					prefix := len(url)
+					for i := 0; i < n; i++ {
+						filter.Add(strconv.AppendInt(url[:prefix], int64(i), 10))
+					}
+					// half of probes are missing
+					probes := make([][]byte, 1<<16)
+					for i := range probes {
+						probes[i] = strconv.AppendInt([]byte("https://example.com/"), rand.Int63n(int64(2*n)), 10)
+					}
+					b.ResetTimer()
+
+					for i := 0; i < b.N; i++ {
+						filter.Contain(probes[i%len(probes)])
+					}
+				})
+			}
+		})
+	}
+}
@@ -3,16 +3,21 @@ package bloom_test
 import (
 	"bloom"
 	"bloom/customhash"
+	"bloom/hashspec"
+	"bloom/multiplehash"
 	"bloom/salthash"
 	"crypto"
 	"fmt"
 	"hash"
+	"hash/fnv"
+	"sync"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v6"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/twmb/murmur3"
 
 	_ "crypto/md5"
 
@@ -114,10 +119,171 @@ func TestBloomFilter(t *testing.T) {
 	}
 }
 
+// stringFilter is a bloom.Filter that can be stored as string.
+type stringFilter interface {
+	bloom.Filter
+	String() string
+	LoadFingerprint(string) error
+}
+
+func TestBloomFilterWithoutHash(t *testing.T) {
+	// the whole hash result is used, there is no default hash
+	_, err := bloom.New()
+	assert.ErrorIs(t, err, multiplehash.ErrInvalidHashList)
+	_, err = bloom.NewWithEstimates(1000, 0.01)
+	assert.ErrorIs(t, err, multiplehash.ErrInvalidHashList)
+
+	// murmur3 by default
+	_, err = bloom.NewDoubleHashing(1000, 0.01)
+	assert.NoError(t, err)
+	_, err = bloom.NewAgePartitioned(1000, 0.01, 3, 0)
+	assert.NoError(t, err)
+}
+
+func TestBloomFilterWithEstimates(t *testing.T) {
+	tests := []struct {
+		name          string
+		n             uint64
+		fpRate        float64
+		hashList      []hash.Hash
+		doubleHashing bool
+		wantM         uint64
+		wantK         uint64
+		wantErr       error
+	}{
+		{
+			name:    "zero",
+			n:       0,
+			fpRate:  0.05,
+			wantErr: bloom.ErrInvalidEstimates,
+		},
+		{
+			name:    "invalid fpRate",
+			n:       1000,
+			fpRate:  1,
+			wantErr: bloom.ErrInvalidEstimates,
+		},
+		{
+			name:   "MD5 too short",
+			n:      1000,
+			fpRate: 0.001,
+			hashList: []hash.Hash{
+				crypto.MD5.New(),
+			},
+			wantErr: bloom.ErrHashTooShort,
+		},
+		{
+			name:   "SHA256/5%",
+			n:      100000,
+			fpRate: 0.05,
+			hashList: []hash.Hash{
+				crypto.SHA256.New(),
+			},
+			wantM: 623523,
+			wantK: 4,
+		},
+		{
+			name:   "SHA512/1%",
+			n:      100000,
+			fpRate: 0.01,
+			hashList: []hash.Hash{
+				crypto.SHA512.New(),
+			},
+			wantM: 958506,
+			wantK: 7,
+		},
+		{
+			name:   "DoubleHashing/FNV64 too short",
+			n:      1000,
+			fpRate: 0.01,
+			hashList: []hash.Hash{
+				fnv.New64a(),
+			},
+			doubleHashing: true,
+			wantErr:       bloom.ErrHashTooShort,
+		},
+		{
+			name:          "DoubleHashing/Murmur3/1%",
+			n:             100000,
+			fpRate:        0.01,
+			doubleHashing: true,
+			wantM:         958506,
+			wantK:         7,
+		},
+		{
+			name:          "DoubleHashing/Murmur3/0.1%",
+			n:             100000,
+			fpRate:        0.001,
+			doubleHashing: true,
+			wantM:         1437759,
+			wantK:         10,
+		},
+		{
+			name:   "DoubleHashing/MD5/1%",
+			n:      100000,
+			fpRate: 0.01,
+			hashList: []hash.Hash{
+				crypto.MD5.New(),
+			},
+			doubleHashing: true,
+			wantM:         958506,
+			wantK:         7,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			newFilter := func() (stringFilter, error) {
+				if tt.doubleHashing {
+					return bloom.NewDoubleHashing(tt.n, tt.fpRate, tt.hashList...)
+				}
+				return bloom.NewWithEstimates(tt.n, tt.fpRate, tt.hashList...)
+			}
+			filter, err := newFilter()
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			m, k, err := bloom.EstimateParameters(tt.n, tt.fpRate)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantM, m, "m")
+			assert.Equal(t, tt.wantK, k, "k")
+			assert.InDelta(t, tt.fpRate, bloom.EstimateFalsePositiveRate(m, k, tt.n), tt.fpRate/10)
+
+			for i := uint64(0); i < tt.n; i++ {
+				filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			for i := uint64(0); i < tt.n; i++ {
+				require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+
+			falsePositive := 0
+			for i := tt.n; i < 2*tt.n; i++ {
+				if filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))) {
+					falsePositive++
+				}
+			}
+			// allow some margin over theoretical rate
+			assert.Less(t, float64(falsePositive)/float64(tt.n), tt.fpRate*1.2, "false positive rate")
+
+			// retry with load from string
+			filter2, err := newFilter()
+			require.NoError(t, err)
+			require.NoError(t, filter2.LoadFingerprint(filter.String()))
+			for i := uint64(0); i < tt.n; i += 100 {
+				assert.True(t, filter2.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+		})
+	}
+}
+
 func BenchmarkBloomFilter(b *testing.B) {
 	tests := []struct {
 		name        string
 		hashList    []hash.Hash
+		newFilter   func(n int) (stringFilter, error) // default to bloom.New(hashList...)
 		fingerprint string
 	}{
 		{
@@ -312,7 +478,38 @@ func BenchmarkBloomFilter(b *testing.B) {
 				crypto.BLAKE2b_512.New(),
 			},
 		},
-		// probably than this algo are far from optimal and a more simpler and quickest algo lake xxhash with salt variation could be far better.
+		{
+			name: "SHA512-Estimates",
+			newFilter: func(n int) (stringFilter, error) {
+				return bloom.NewWithEstimates(uint64(n), 0.01, crypto.SHA512.New())
+			},
+		},
+		{
+			name: "BLAKE2b_512-Estimates",
+			newFilter: func(n int) (stringFilter, error) {
+				return bloom.NewWithEstimates(uint64(n), 0.01, crypto.BLAKE2b_512.New())
+			},
+		},
+		{
+			name: "MD5-DoubleHashing",
+			newFilter: func(n int) (stringFilter, error) {
+				return bloom.NewDoubleHashing(uint64(n), 0.01, crypto.MD5.New())
+			},
+		},
+		{
+			name: "Murmur3_128-DoubleHashing",
+			newFilter: func(n int) (stringFilter, error) {
+				return bloom.NewDoubleHashing(uint64(n), 0.01)
+			},
+		},
+	}
+	for i := range tests {
+		if tests[i].newFilter == nil {
+			hashList := tests[i].hashList
+			tests[i].newFilter = func(int) (stringFilter, error) {
+				return bloom.New(hashList...)
+			}
+		}
 	}
 	for name, generator := range map[string]func(i int) string{
 		"id":   func(i int) string { return fmt.Sprint(i) },
@@ -324,7 +521,7 @@ func BenchmarkBloomFilter(b *testing.B) {
 				tt := tt
 				b.Run(tt.name, func(b *testing.B) {
 					b.Run("Add", func(b *testing.B) {
-						filter, err := bloom.New(tt.hashList...)
+						filter, err := tt.newFilter(b.N)
 						require.NoError(b, err)
 
 						nbObjectInFilter := b.N
@@ -332,6 +529,7 @@ func BenchmarkBloomFilter(b *testing.B) {
 						for i := 0; i < nbObjectInFilter; i++ {
 							objects = append(objects, []byte(generator(i)))
 						}
+						b.ReportAllocs()
 						b.ResetTimer()
 
 						for _, o := range objects {
@@ -343,7 +541,7 @@ func BenchmarkBloomFilter(b *testing.B) {
 					b.Run("Contain", func(b *testing.B) {
 						b.Run("Positive", func(b *testing.B) {
 							false_negative := float64(0)
-							filter, err := bloom.New(tt.hashList...)
+							filter, err := tt.newFilter(b.N)
 							require.NoError(b, err)
 
 							nbObjectInFilter := b.N
@@ -354,6 +552,7 @@ func BenchmarkBloomFilter(b *testing.B) {
 							for _, o := range objects {
 								filter.Add(o)
 							}
+							b.ReportAllocs()
 							b.ResetTimer()
 
 							for _, o := range objects {
@@ -367,7 +566,7 @@ func BenchmarkBloomFilter(b *testing.B) {
 							b.Run(fmt.Sprint(nbObjectInFilter), func(b *testing.B) {
 								b.Run("False", func(b *testing.B) {
 									false_positive := float64(0)
-									filter, err := bloom.New(tt.hashList...)
+									filter, err := tt.newFilter(nbObjectInFilter)
 									require.NoError(b, err)
 
 									nbObjectMissing := float64(b.N)
@@ -382,6 +581,7 @@ func BenchmarkBloomFilter(b *testing.B) {
 									for i := 0; i < int(nbObjectMissing); i++ {
 										missing_objects = append(missing_objects, []byte(generator(nbObjectInFilter+i)))
 									}
+									b.ReportAllocs()
 									b.ResetTimer()
 
 									for _, o := range missing_objects { // could probably happen but should not in theses restricted cases
@@ -405,3 +605,158 @@ func BenchmarkBloomFilter(b *testing.B) {
 func skipError(h hash.Hash, _ error) hash.Hash {
 	return h
 }
+
+func TestBloomFilterAllocs(t *testing.T) {
+	tests := []struct {
+		name      string
+		hash      hash.Hash
+		newFilter func() (bloom.Filter, error)
+	}{
+		{
+			name: "MD5",
+			hash: crypto.MD5.New(),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.New(crypto.MD5.New())
+			},
+		},
+		{
+			name: "SHA256-Estimates",
+			hash: crypto.SHA256.New(),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, crypto.SHA256.New())
+			},
+		},
+		{
+			name: "Murmur3_128-DoubleHashing",
+			hash: murmur3.New128(),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01)
+			},
+		},
+		{
+			name: "MD5-DoubleHashing",
+			hash: crypto.MD5.New(),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01, crypto.MD5.New())
+			},
+		},
+		{
+			name: "Murmur3_128-Blocked",
+			hash: murmur3.New128(),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewBlocked(1000, 0.01)
+			},
+		},
+		{
+			name: "SHA512x2",
+			hash: skipError(multiplehash.New(crypto.SHA512.New(), salthash.New(crypto.SHA512.New(), []byte("some_well_crafted_salt")))),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.New(crypto.SHA512.New(), salthash.New(crypto.SHA512.New(), []byte("some_well_crafted_salt")))
+			},
+		},
+		{
+			name: "BLAKE2b_512x2-DoubleHashing",
+			hash: skipError(multiplehash.New(crypto.BLAKE2b_512.New(), salthash.New(crypto.BLAKE2b_512.New(), []byte("some_well_crafted_salt")))),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01, crypto.BLAKE2b_512.New(), salthash.New(crypto.BLAKE2b_512.New(), []byte("some_well_crafted_salt")))
+			},
+		},
+		{
+			name: "SHA512xCustom2-Estimates",
+			hash: skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})))
+			},
+		},
+		{
+			name: "PooledSHA512-Estimates",
+			hash: crypto.SHA512.New(),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, bloom.PooledHash(crypto.SHA512.New))
+			},
+		},
+		{
+			name: "Spec-DoubleHashing",
+			hash: skipError(hashspec.New(`multi(custom(sha512, salts=2, seed="s"), salt(murmur3, "x"))`)),
+			newFilter: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01, skipError(hashspec.New(`multi(custom(sha512, salts=2, seed="s"), salt(murmur3, "x"))`)))
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.newFilter()
+			require.NoError(t, err)
+
+			object := []byte("https://example.com/")
+			if !raceEnabled {
+				assert.Zero(t, testing.AllocsPerRun(100, func() { filter.Add(object) }), "Add")
+				assert.Zero(t, testing.AllocsPerRun(100, func() { filter.Contain(object) }), "Contain")
+			}
+			filter.Add(object)
+			assert.True(t, filter.Contain(object))
+
+			tt.hash.Write(object)
+			assert.True(t, filter.ContainFingerprint(tt.hash.Sum(nil)), "same fingerprint as hash")
+		})
+	}
+}
+
+func TestBloomFilterConcurrentHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		hashList func() []hash.Hash
+	}{
+		{
+			name:     "MD5",
+			hashList: func() []hash.Hash { return []hash.Hash{crypto.MD5.New()} },
+		},
+		{
+			name: "SHA512x2",
+			hashList: func() []hash.Hash {
+				return []hash.Hash{crypto.SHA512.New(), salthash.New(crypto.SHA512.New(), []byte("some_well_crafted_salt"))}
+			},
+		},
+		{
+			name:     "Spec",
+			hashList: func() []hash.Hash { return []hash.Hash{skipError(hashspec.New(`custom(sha256, salts=2, seed="s")`))} },
+		},
+		{
+			name: "PooledSHA512x2",
+			hashList: func() []hash.Hash {
+				return []hash.Hash{bloom.PooledHash(func() hash.Hash {
+					return skipError(multiplehash.New(crypto.SHA512.New(), salthash.New(crypto.SHA512.New(), []byte("some_well_crafted_salt"))))
+				})}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := bloom.NewDoubleHashing(10000, 0.01, tt.hashList()...)
+			require.NoError(t, err)
+			serial, err := bloom.NewDoubleHashing(10000, 0.01, tt.hashList()...)
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				g := g
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := g; i < 8000; i += 8 {
+						filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+						filter.Contain([]byte(fmt.Sprintf("https://example.org/%d", i)))
+					}
+				}()
+			}
+			wg.Wait()
+
+			for i := 0; i < 8000; i++ {
+				serial.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			assert.Equal(t, serial.String(), filter.String(), "same bits as serial adds")
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bloom"
+	"bloom/cuckoo"
+	"bloom/fuse"
+	"bloom/hashspec"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+var ErrFalseNegative = errors.New("false negative")
+
+// evaluated is a filter built from the keys.
+type evaluated interface {
+	bloom.ReadOnlyFilter
+	ByteSize() uint64
+}
+
+// config is a filter configuration to evaluate.
+type config struct {
+	name string
+	// build return a filter containing keys, sized for len(keys) objects with a fpRate false positive rate.
+	build func(keys [][]byte, fpRate float64) (evaluated, error)
+	// theoretical return the false positive rate expected for f once n objects are added.
+	theoretical func(f evaluated, n uint64, fpRate float64) float64
+}
+
+// result is the evaluation of a config.
+type result struct {
+	Config         string  `json:"config"`
+	Keys           int     `json:"keys"`
+	Probes         int     `json:"probes"`
+	BitsPerKey     float64 `json:"bits_per_key"`
+	TargetFPR      float64 `json:"target_fpr"`
+	TheoreticalFPR float64 `json:"theoretical_fpr"`
+	MeasuredFPR    float64 `json:"measured_fpr"`
+	AddNsPerOp     float64 `json:"add_ns_per_op"`
+	ContainNsPerOp float64 `json:"contain_ns_per_op"`
+}
+
+// defaultConfigs return the configurations evaluated by default.
+func defaultConfigs() []config {
+	return []config{
+		{
+			name: "chunk/sha512",
+			build: adding(func(n uint64, fpRate float64) (bloom.Filter, error) {
+				return bloom.NewWithEstimates(n, fpRate, sha512.New())
+			}),
+			theoretical: classic,
+		},
+		{
+			name: "double-hashing/murmur3",
+			build: adding(func(n uint64, fpRate float64) (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(n, fpRate)
+			}),
+			theoretical: classic,
+		},
+		{
+			name: "blocked/murmur3",
+			build: adding(func(n uint64, fpRate float64) (bloom.Filter, error) {
+				return bloom.NewBlocked(n, fpRate)
+			}),
+			theoretical: blocked,
+		},
+		{
+			name: "counting/murmur3",
+			build: adding(func(n uint64, fpRate float64) (bloom.Filter, error) {
+				return bloom.NewCounting(n, fpRate)
+			}),
+			theoretical: classic,
+		},
+		{
+			name: "cuckoo/murmur3",
+			build: adding(func(n uint64, fpRate float64) (bloom.Filter, error) {
+				return cuckoo.New(n, fpRate)
+			}),
+			theoretical: cuckooRate,
+		},
+		{
+			name: "fuse/murmur3",
+			build: func(keys [][]byte, _ float64) (evaluated, error) {
+				return fuse.New(keys)
+			},
+			// a random fingerprint match the xor of 8 bits fingerprints
+			theoretical: func(evaluated, uint64, float64) float64 { return 1.0 / 256 },
+		},
+	}
+}
+
+// specConfig return a double hashing configuration with the hash of spec.
+func specConfig(spec string) (config, error) {
+	s, err := hashspec.Parse(spec)
+	if err != nil {
+		return config{}, err
+	}
+
+	return config{
+		name: "double-hashing/" + s.String(),
+		build: adding(func(n uint64, fpRate float64) (bloom.Filter, error) {
+			return bloom.NewDoubleHashing(n, fpRate, s.New())
+		}),
+		theoretical: classic,
+	}, nil
+}
+
+// adding return a build function adding keys one by one to the filter created by newFilter.
+func adding(newFilter func(n uint64, fpRate float64) (bloom.Filter, error)) func(keys [][]byte, fpRate float64) (evaluated, error) {
+	return func(keys [][]byte, fpRate float64) (evaluated, error) {
+		f, err := newFilter(uint64(len(keys)), fpRate)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := f.(evaluated)
+		if !ok {
+			return nil, fmt.Errorf("%T has no ByteSize", f)
+		}
+		for _, key := range keys {
+			f.Add(key)
+		}
+		return e, nil
+	}
+}
+
+// classic is the false positive rate of a bloom filter using all its bits for every object,
+// sized by bloom.EstimateParameters like the constructors do.
+func classic(_ evaluated, n uint64, fpRate float64) float64 {
+	m, k, _ := bloom.EstimateParameters(n, fpRate)
+	return bloom.EstimateFalsePositiveRate(m, k, n)
+}
+
+// blocked is the false positive rate of a blocked bloom filter: objects are spread over blocks
+// with a Poisson distribution and each block of bloom.BlockBits behave as a small bloom filter.
+func blocked(f evaluated, n uint64, fpRate float64) float64 {
+	_, k, _ := bloom.EstimateParameters(n, fpRate)
+	blocks := f.(interface{ Stats() bloom.Stats }).Stats().Bits / bloom.BlockBits
+	lambda := float64(n) / float64(blocks)
+
+	rate := 0.0
+	for i := 0; float64(i) < lambda+10*math.Sqrt(lambda)+10; i++ {
+		lgamma, _ := math.Lgamma(float64(i) + 1)
+		p := math.Exp(float64(i)*math.Log(lambda) - lambda - lgamma)
+		rate += p * bloom.EstimateFalsePositiveRate(bloom.BlockBits, k, uint64(i))
+	}
+	return rate
+}
+
+// cuckooRate is the false positive rate of a cuckoo filter: a lookup compare the fingerprint
+// to the occupied entries of 2 buckets.
+func cuckooRate(f evaluated, _ uint64, _ float64) float64 {
+	c := f.(*cuckoo.CuckooFilter)
+	occupied := 2 * cuckoo.BucketSize * c.LoadFactor()
+	return 1 - math.Pow(1-math.Pow(2, -float64(c.FingerprintBits())), occupied)
+}
+
+// generateURLs return n distinct URLs generated like the producer pages, none of them in exclude.
+func generateURLs(faker *gofakeit.Faker, n int, exclude map[string]struct{}) ([][]byte, map[string]struct{}) {
+	seen := make(map[string]struct{}, n)
+	urls := make([][]byte, 0, n)
+	for i := 0; len(urls) < n; i++ {
+		u, err := url.Parse(faker.URL())
+		if err != nil {
+			continue
+		}
+
+		s := u.String()
+		if _, ok := seen[s]; ok {
+			// the fake URL space is small, make duplicates distinct
+			u.Path += "/" + strconv.Itoa(i)
+			s = u.String()
+		}
+		_, excluded := exclude[s]
+		if _, ok := seen[s]; ok || excluded {
+			continue
+		}
+
+		seen[s] = struct{}{}
+		urls = append(urls, []byte(s))
+	}
+
+	return urls, seen
+}
+
+// evaluate build the filter of c from keys, then count false positives on probes, none of them in keys.
+func evaluate(c config, keys, probes [][]byte, fpRate float64) (result, error) {
+	start := time.Now()
+	f, err := c.build(keys, fpRate)
+	if err != nil {
+		return result{}, fmt.Errorf("%s: %w", c.name, err)
+	}
+	addTime := time.Since(start)
+
+	for _, key := range keys {
+		if !f.Contain(key) {
+			return result{}, fmt.Errorf("%w: %s miss %s", ErrFalseNegative, c.name, key)
+		}
+	}
+
+	positives := 0
+	start = time.Now()
+	for _, probe := range probes {
+		if f.Contain(probe) {
+			positives++
+		}
+	}
+	containTime := time.Since(start)
+
+	n := uint64(len(keys))
+	return result{
+		Config:         c.name,
+		Keys:           len(keys),
+		Probes:         len(probes),
+		BitsPerKey:     float64(f.ByteSize()*8) / float64(n),
+		TargetFPR:      fpRate,
+		TheoreticalFPR: c.theoretical(f, n, fpRate),
+		MeasuredFPR:    float64(positives) / float64(len(probes)),
+		AddNsPerOp:     float64(addTime.Nanoseconds()) / float64(len(keys)),
+		ContainNsPerOp: float64(containTime.Nanoseconds()) / float64(len(probes)),
+	}, nil
+}
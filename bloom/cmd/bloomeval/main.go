@@ -0,0 +1,119 @@
+// Command bloomeval compare filter configurations on synthetic URLs: it insert keys generated like the producer pages,
+// probe URLs never inserted and print for each configuration the measured and theoretical false positive rates,
+// the bits used by key and the time by operation.
+//
+//	bloomeval -keys 1000000 -probes 1000000 -fp-rate 0.001 -spec 'custom(sha256, salts=2, seed="s")' -format json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// specs is the list of -spec flags.
+type specs []string
+
+func (s *specs) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *specs) Set(spec string) error {
+	*s = append(*s, spec)
+	return nil
+}
+
+func main() {
+	var (
+		keys     = flag.Int("keys", 100000, "number of URLs inserted")
+		probes   = flag.Int("probes", 100000, "number of unseen URLs probed")
+		fpRate   = flag.Float64("fp-rate", 0.01, "false positive rate the filters are sized for")
+		seed     = flag.Int64("seed", 1, "seed of the URL generator")
+		format   = flag.String("format", "table", "output format, table or json")
+		only     = flag.Bool("only-specs", false, "only evaluate the -spec configurations")
+		hashSpec specs
+	)
+	flag.Var(&hashSpec, "spec", "hash spec evaluated with a double hashing filter, can be repeated")
+	flag.Parse()
+
+	if *keys < 1 || *probes < 1 {
+		fmt.Fprintln(os.Stderr, "keys and probes should be positive")
+		os.Exit(2)
+	}
+	write, ok := writers[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	var configs []config
+	if !*only {
+		configs = defaultConfigs()
+	}
+	for _, spec := range hashSpec {
+		c, err := specConfig(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		configs = append(configs, c)
+	}
+
+	results, err := run(configs, *keys, *probes, *fpRate, *seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := write(os.Stdout, results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run evaluate every config on the same keys and probes.
+func run(configs []config, keys, probes int, fpRate float64, seed int64) ([]result, error) {
+	faker := gofakeit.New(seed)
+	inserted, seen := generateURLs(faker, keys, nil)
+	unseen, _ := generateURLs(faker, probes, seen)
+
+	results := make([]result, 0, len(configs))
+	for _, c := range configs {
+		r, err := evaluate(c, inserted, unseen, fpRate)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// writers are the output formats.
+var writers = map[string]func(w io.Writer, results []result) error{
+	"table": writeTable,
+	"json":  writeJSON,
+}
+
+func writeTable(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "config\tkeys\tprobes\tbits/key\ttarget fpr\ttheoretical fpr\tmeasured fpr\tadd ns/op\tcontain ns/op\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.4f%%\t%.4f%%\t%.4f%%\t%.1f\t%.1f\t\n",
+			r.Config, r.Keys, r.Probes, r.BitsPerKey,
+			r.TargetFPR*100, r.TheoreticalFPR*100, r.MeasuredFPR*100,
+			r.AddNsPerOp, r.ContainNsPerOp)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, results []result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
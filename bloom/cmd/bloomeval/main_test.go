@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	spec, err := specConfig(`custom(sha256, salts=1, seed="s")`)
+	require.NoError(t, err)
+
+	results, err := run(append(defaultConfigs(), spec), 5000, 20000, 0.01, 1)
+	require.NoError(t, err)
+	require.Len(t, results, len(defaultConfigs())+1)
+
+	for _, r := range results {
+		assert.Equal(t, 5000, r.Keys, r.Config)
+		assert.Equal(t, 20000, r.Probes, r.Config)
+		assert.Greater(t, r.BitsPerKey, 8.0, r.Config)
+		// measured rate stay close to the theory, about 4 standard deviations of a 20000 probes sample
+		assert.InDelta(t, r.TheoreticalFPR, r.MeasuredFPR, 0.003, r.Config)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeJSON(&buf, results))
+	var decoded []result
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, results, decoded)
+
+	buf.Reset()
+	require.NoError(t, writeTable(&buf, results))
+	assert.Equal(t, len(results)+1, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestGenerateURLs(t *testing.T) {
+	faker := gofakeit.New(1)
+	keys, seen := generateURLs(faker, 1000, nil)
+	probes, _ := generateURLs(faker, 1000, seen)
+	assert.Len(t, seen, 1000)
+	for _, p := range probes {
+		assert.NotContains(t, seen, string(p))
+	}
+	assert.Len(t, keys, 1000)
+}
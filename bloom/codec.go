@@ -0,0 +1,211 @@
+package bloom
+
+import (
+	"encoding/ascii85"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// check interface implementation
+var (
+	_ Codec = ascii85Codec{}
+	_ Codec = base64Codec{}
+	_ Codec = hexCodec{}
+	_ Codec = zstdCodec{}
+)
+
+var (
+	ErrLengthMismatch = errors.New("decoded length mismatch")
+	ErrCorruptInput   = errors.New("corrupt input")
+	ErrUnknownCodec   = errors.New("unknown codec")
+)
+
+// codecSeparator end the codec name prefixing an encoded fingerprint,
+// it is never produced by the built-in codecs so strings without prefix are detected as ascii85.
+const codecSeparator = "~"
+
+var (
+	// ASCII85 is the shortest plain text encoding, 5 characters for 4 bytes.
+	ASCII85 Codec = ascii85Codec{}
+	// Base64URL is safe in URLs and file names, 4 characters for 3 bytes.
+	Base64URL Codec = base64Codec{}
+	// Hex is the most readable, 2 characters by byte.
+	Hex Codec = hexCodec{}
+	// ZstdBase64 compress the bits before encoding them in base64url, far shorter for filters with few bits set.
+	ZstdBase64 Codec = zstdCodec{}
+)
+
+// Codec encode a filter bits as text, to store them in a text field.
+type Codec interface {
+	// Name identify the codec in encoded strings, it should not contain codecSeparator.
+	Name() string
+	// Encode return the text representation of src.
+	Encode(src []byte) string
+	// Decode decode s in dst, s should encode exactly len(dst) bytes.
+	// Errors should wrap ErrLengthMismatch or ErrCorruptInput.
+	Decode(dst []byte, s string) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	for _, c := range []Codec{ASCII85, Base64URL, Hex, ZstdBase64} {
+		RegisterCodec(c)
+	}
+}
+
+// RegisterCodec make c available to LoadFingerprint, replacing any codec with the same name.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+// lookupCodec return the codec of an encoded string and the encoded data.
+// Strings without codec prefix were produced by String before codecs and are ascii85.
+func lookupCodec(s string) (Codec, string, error) {
+	name, data, found := strings.Cut(s, codecSeparator)
+	if !found {
+		return ASCII85, s, nil
+	}
+
+	codecsMu.RLock()
+	c, ok := codecs[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+
+	return c, data, nil
+}
+
+// encodeWith return src encoded by c, prefixed by c name.
+func encodeWith(c Codec, src []byte) string {
+	return c.Name() + codecSeparator + c.Encode(src)
+}
+
+type ascii85Codec struct{}
+
+func (ascii85Codec) Name() string { return "ascii85" }
+
+func (ascii85Codec) Encode(src []byte) string {
+	out := make([]byte, ascii85.MaxEncodedLen(len(src)))
+	return string(out[:ascii85.Encode(out, src)])
+}
+
+func (ascii85Codec) Decode(dst []byte, s string) error {
+	// one spare group to detect longer input
+	buf := make([]byte, len(dst)+4)
+	n, consumed, err := ascii85.Decode(buf, []byte(s), true)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptInput, err)
+	}
+	if n != len(dst) || consumed != len(s) {
+		return fmt.Errorf("%w: decoded at least %d bytes, expected %d", ErrLengthMismatch, n, len(dst))
+	}
+	copy(dst, buf)
+
+	return nil
+}
+
+type base64Codec struct{}
+
+func (base64Codec) Name() string { return "base64url" }
+
+func (base64Codec) Encode(src []byte) string {
+	return base64.RawURLEncoding.EncodeToString(src)
+}
+
+func (base64Codec) Decode(dst []byte, s string) error {
+	if n := base64.RawURLEncoding.DecodedLen(len(s)); n != len(dst) {
+		return fmt.Errorf("%w: decoded %d bytes, expected %d", ErrLengthMismatch, n, len(dst))
+	}
+	if _, err := base64.RawURLEncoding.Decode(dst, []byte(s)); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptInput, err)
+	}
+
+	return nil
+}
+
+type hexCodec struct{}
+
+func (hexCodec) Name() string { return "hex" }
+
+func (hexCodec) Encode(src []byte) string {
+	return hex.EncodeToString(src)
+}
+
+func (hexCodec) Decode(dst []byte, s string) error {
+	if n := hex.DecodedLen(len(s)); n != len(dst) || len(s)%2 != 0 {
+		return fmt.Errorf("%w: decoded %d bytes, expected %d", ErrLengthMismatch, n, len(dst))
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptInput, err)
+	}
+
+	return nil
+}
+
+// zstd encoder and decoder are safe for concurrent EncodeAll and DecodeAll, created on first use.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	// errors are only returned for invalid options
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	// DecodeAll never decode more than the capacity of dst, whatever the frame headers say
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecodeAllCapLimit(true))
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd+base64url" }
+
+func (zstdCodec) Encode(src []byte) string {
+	zstdOnce.Do(initZstd)
+	return base64.RawURLEncoding.EncodeToString(zstdEncoder.EncodeAll(src, nil))
+}
+
+func (zstdCodec) Decode(dst []byte, s string) error {
+	compressed, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptInput, err)
+	}
+
+	// the first frame header give the decoded size, checked to report a mismatch before decoding,
+	// following concatenated frames are only bounded by the capacity of dst
+	var header zstd.Header
+	if err := header.Decode(compressed); err != nil || !header.HasFCS {
+		return fmt.Errorf("%w: invalid zstd frame header", ErrCorruptInput)
+	}
+	if header.FrameContentSize != uint64(len(dst)) {
+		return fmt.Errorf("%w: decoded %d bytes, expected %d", ErrLengthMismatch, header.FrameContentSize, len(dst))
+	}
+
+	zstdOnce.Do(initZstd)
+	out, err := zstdDecoder.DecodeAll(compressed, dst[:0:len(dst)])
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) { // concatenated frames
+		return fmt.Errorf("%w: decoded more than %d bytes", ErrLengthMismatch, len(dst))
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptInput, err)
+	}
+	if len(out) != len(dst) {
+		return fmt.Errorf("%w: decoded %d bytes, expected %d", ErrLengthMismatch, len(out), len(dst))
+	}
+
+	return nil
+}
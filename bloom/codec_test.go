@@ -0,0 +1,205 @@
+package bloom_test
+
+import (
+	"bloom"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec(t *testing.T) {
+	n := uint64(10000)
+	objects := 100
+
+	for _, c := range []bloom.Codec{bloom.ASCII85, bloom.Base64URL, bloom.Hex, bloom.ZstdBase64} {
+		c := c
+		t.Run(c.Name(), func(t *testing.T) {
+			filter, err := bloom.NewDoubleHashing(n, 0.01)
+			require.NoError(t, err)
+			for i := 0; i < objects; i++ {
+				filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+
+			encoded := filter.EncodeFingerprint(c)
+			assert.True(t, strings.HasPrefix(encoded, c.Name()+"~"))
+			t.Logf("%d characters", len(encoded))
+
+			loaded, err := bloom.NewDoubleHashing(n, 0.01)
+			require.NoError(t, err)
+			require.NoError(t, loaded.LoadFingerprint(encoded))
+			assert.Equal(t, filter.String(), loaded.String())
+			for i := 0; i < objects; i++ {
+				require.True(t, loaded.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+		})
+	}
+
+	// few bits set compress well
+	filter, err := bloom.NewDoubleHashing(n, 0.01)
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+	assert.Less(t, len(filter.EncodeFingerprint(bloom.ZstdBase64)), len(filter.EncodeFingerprint(bloom.ASCII85))/10)
+}
+
+func TestCodecLegacy(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+
+	// String had no codec prefix and was padded with NUL bytes
+	for _, encoded := range []string{filter.String(), filter.String() + strings.Repeat("\x00", 100)} {
+		loaded, err := bloom.NewDoubleHashing(1000, 0.01)
+		require.NoError(t, err)
+		require.NoError(t, loaded.LoadFingerprint(encoded))
+		assert.True(t, loaded.Contain([]byte("https://example.com/")))
+	}
+}
+
+func TestCodecInvalid(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+	larger, err := bloom.NewDoubleHashing(2000, 0.01)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		encoded string
+		err     error
+	}{
+		{
+			name:    "unknown codec",
+			encoded: "rot13~" + filter.String(),
+			err:     bloom.ErrUnknownCodec,
+		},
+	}
+	for _, c := range []bloom.Codec{bloom.ASCII85, bloom.Base64URL, bloom.Hex, bloom.ZstdBase64} {
+		encoded := filter.EncodeFingerprint(c)
+		truncatedErr := bloom.ErrLengthMismatch
+		if c == bloom.ZstdBase64 { // the frame header still give the right size
+			truncatedErr = bloom.ErrCorruptInput
+		}
+		tests = append(tests, []struct {
+			name    string
+			encoded string
+			err     error
+		}{
+			{
+				name:    c.Name() + " truncated",
+				encoded: encoded[:len(encoded)-8],
+				err:     truncatedErr,
+			},
+			{
+				name:    c.Name() + " longer",
+				encoded: larger.EncodeFingerprint(c),
+				err:     bloom.ErrLengthMismatch,
+			},
+			{
+				name:    c.Name() + " corrupt",
+				encoded: encoded[:len(encoded)-8] + "{{{{{{{{",
+				err:     bloom.ErrCorruptInput,
+			},
+		}...)
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := bloom.NewDoubleHashing(1000, 0.01)
+			require.NoError(t, err)
+			loaded.Add([]byte("https://example.com/loaded"))
+
+			assert.ErrorIs(t, loaded.LoadFingerprint(tt.encoded), tt.err)
+			// never half loaded
+			assert.True(t, loaded.Contain([]byte("https://example.com/loaded")))
+			assert.False(t, loaded.Contain([]byte("https://example.com/")))
+		})
+	}
+}
+
+func TestCodecZstdConcatenated(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+	encoded := filter.EncodeFingerprint(bloom.ZstdBase64)
+	prefix := bloom.ZstdBase64.Name() + "~"
+	first, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encoded, prefix))
+	require.NoError(t, err)
+
+	zeros := make([]byte, 256<<20)
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	require.NoError(t, err)
+	// a streamed frame has no content size in its header
+	var streamed bytes.Buffer
+	writer, err := zstd.NewWriter(&streamed, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithWindowSize(zstd.MaxWindowSize))
+	require.NoError(t, err)
+	_, err = writer.Write(zeros)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{
+			name:  "sized",
+			frame: encoder.EncodeAll(zeros, nil),
+		},
+		{
+			name:  "streamed",
+			frame: streamed.Bytes(),
+		},
+	}
+	zeros = nil
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			data := prefix + base64.RawURLEncoding.EncodeToString(append(append([]byte{}, first...), tt.frame...))
+			loaded, err := bloom.NewDoubleHashing(1000, 0.01)
+			require.NoError(t, err)
+
+			// only the first frame header is checked, the following frames must not be decoded
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			assert.ErrorIs(t, loaded.LoadFingerprint(data), bloom.ErrLengthMismatch)
+			runtime.ReadMemStats(&after)
+			assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20), "allocated bytes")
+			assert.False(t, loaded.Contain([]byte("https://example.com/")))
+		})
+	}
+}
+
+// upperHex is a custom codec.
+type upperHex struct{}
+
+func (upperHex) Name() string { return "HEX" }
+
+func (upperHex) Encode(src []byte) string {
+	return strings.ToUpper(hex.EncodeToString(src))
+}
+
+func (upperHex) Decode(dst []byte, s string) error {
+	return bloom.Hex.Decode(dst, strings.ToLower(s))
+}
+
+func TestRegisterCodec(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+
+	encoded := filter.EncodeFingerprint(upperHex{})
+	loaded, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	assert.ErrorIs(t, loaded.LoadFingerprint(encoded), bloom.ErrUnknownCodec)
+
+	bloom.RegisterCodec(upperHex{})
+	require.NoError(t, loaded.LoadFingerprint(encoded))
+	assert.True(t, loaded.Contain([]byte("https://example.com/")))
+}
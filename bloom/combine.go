@@ -0,0 +1,116 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrIncompatible = errors.New("incompatible filters")
+
+// IncompatibleError report the parameter that differ between two filters that can not be combined.
+type IncompatibleError struct {
+	Parameter string
+	Have      any
+	Want      any
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("%s: %s %v != %v", ErrIncompatible, e.Parameter, e.Have, e.Want)
+}
+
+func (e *IncompatibleError) Unwrap() error {
+	return ErrIncompatible
+}
+
+// Union add to the filter all objects of other.
+// Both filters should have the same size and hash configuration.
+func (f *filter) Union(other Filter) error {
+	o, err := snapshot(f, other)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// checked under the write lock as a ReadFrom can change the filter size
+	if err := f.compatible(o); err != nil {
+		return err
+	}
+	orBytes(f.fingerprint, o.fingerprint)
+	f.count += o.count
+
+	return nil
+}
+
+// Intersect keep in the filter only objects also in other.
+// The false positive rate of the result is higher than a filter built from the intersection.
+// Both filters should have the same size and hash configuration.
+func (f *filter) Intersect(other Filter) error {
+	o, err := snapshot(f, other)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.compatible(o); err != nil {
+		return err
+	}
+	for i, v := range f.fingerprint {
+		f.fingerprint[i] = v & o.fingerprint[i]
+	}
+	if o.count < f.count {
+		f.count = o.count
+	}
+
+	return nil
+}
+
+// baseFilter is implemented by filters embedding a *filter, like the memory mapped filter, their bits can be combined.
+type baseFilter interface {
+	base() *filter
+}
+
+func (f *filter) base() *filter {
+	return f
+}
+
+// snapshot return a copy of the bits and parameters of other to combine with f.
+// Copying avoid holding both locks at the same time.
+func snapshot(f *filter, other Filter) (*filter, error) {
+	b, ok := other.(baseFilter)
+	if !ok {
+		return nil, &IncompatibleError{Parameter: "type", Have: fmt.Sprintf("%T", f), Want: fmt.Sprintf("%T", other)}
+	}
+	o := b.base()
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return &filter{
+		fingerprint: append([]byte(nil), o.fingerprint...),
+		strategy:    o.strategy,
+		m:           o.m,
+		k:           o.k,
+		count:       o.count,
+		hashID:      o.hashID,
+	}, nil
+}
+
+// compatible return an error if the snapshot o can not be combined with f, f.mu should be held.
+func (f *filter) compatible(o *filter) error {
+	switch {
+	case f.strategy != o.strategy:
+		return &IncompatibleError{Parameter: "strategy", Have: f.strategy, Want: o.strategy}
+	case f.hashID != o.hashID:
+		return &IncompatibleError{Parameter: "hash", Have: f.hashID, Want: o.hashID}
+	case f.m != o.m || len(f.fingerprint) != len(o.fingerprint):
+		return &IncompatibleError{Parameter: "m", Have: f.m, Want: o.m}
+	case f.k != o.k:
+		return &IncompatibleError{Parameter: "k", Have: f.k, Want: o.k}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// combinableFilter is a bloom.Filter that can be combined with others.
+type combinableFilter interface {
+	bloom.Filter
+	Union(bloom.Filter) error
+	Intersect(bloom.Filter) error
+	Stats() bloom.Stats
+}
+
+func TestBloomFilterUnionIntersect(t *testing.T) {
+	newFilter := func(from, to int) combinableFilter {
+		filter, err := bloom.NewDoubleHashing(10000, 0.01)
+		require.NoError(t, err)
+		for i := from; i < to; i++ {
+			filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+		}
+		return filter
+	}
+
+	t.Run("Union", func(t *testing.T) {
+		a, b := newFilter(0, 2000), newFilter(1000, 3000)
+		require.NoError(t, a.Union(b))
+
+		for i := 0; i < 3000; i++ {
+			require.True(t, a.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+		}
+		assert.Equal(t, uint64(4000), a.Stats().Count)
+		assert.InEpsilon(t, 3000, a.Stats().EstimatedCount, 0.05)
+	})
+
+	t.Run("Intersect", func(t *testing.T) {
+		a, b := newFilter(0, 2000), newFilter(1000, 3000)
+		require.NoError(t, a.Intersect(b))
+
+		falsePositive := 0
+		for i := 0; i < 3000; i++ {
+			contain := a.Contain([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			if i >= 1000 && i < 2000 {
+				require.True(t, contain, "false negative")
+			} else if contain {
+				falsePositive++
+			}
+		}
+		assert.Less(t, float64(falsePositive)/2000, 0.01, "false positive rate")
+	})
+
+	t.Run("Mapped", func(t *testing.T) {
+		mapped, err := bloom.CreateMapped(filepath.Join(t.TempDir(), "filter.bloom"), 10000, 0.01)
+		require.NoError(t, err)
+		defer mapped.Close()
+		mapped.Add([]byte("https://example.com/mapped"))
+
+		// same bits layout in memory and in a file
+		a := newFilter(0, 100)
+		require.NoError(t, a.Union(mapped))
+		require.NoError(t, mapped.Union(a))
+		assert.True(t, a.Contain([]byte("https://example.com/mapped")))
+		assert.True(t, mapped.Contain([]byte("https://example.com/0")))
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		a, b := newFilter(0, 100), newFilter(100, 200)
+		large, err := bloom.NewDoubleHashing(20000, 0.01)
+		require.NoError(t, err)
+		largeData, err := large.MarshalBinary()
+		require.NoError(t, err)
+		data, err := a.(binaryFilter).MarshalBinary()
+		require.NoError(t, err)
+
+		// the size of a can change between the compatibility check and the combination
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 2000; i++ {
+				assert.NoError(t, a.(binaryFilter).UnmarshalBinary(largeData))
+				assert.NoError(t, a.(binaryFilter).UnmarshalBinary(data))
+			}
+		}()
+		for i := 0; i < 2000; i++ {
+			if err := a.Union(b); err != nil {
+				assert.ErrorIs(t, err, bloom.ErrIncompatible)
+			}
+			if err := a.Intersect(b); err != nil {
+				assert.ErrorIs(t, err, bloom.ErrIncompatible)
+			}
+		}
+		<-done
+	})
+
+	t.Run("Self", func(t *testing.T) {
+		a := newFilter(0, 100)
+		require.NoError(t, a.Union(a))
+		require.NoError(t, a.Intersect(a))
+		assert.True(t, a.Contain([]byte("https://example.com/0")))
+	})
+}
+
+func TestBloomFilterIncompatible(t *testing.T) {
+	tests := []struct {
+		name      string
+		other     func() (bloom.Filter, error)
+		parameter string
+	}{
+		{
+			name: "size",
+			other: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01)
+			},
+			parameter: "m",
+		},
+		{
+			name: "hash",
+			other: func() (bloom.Filter, error) {
+				return bloom.NewDoubleHashing(10000, 0.01, crypto.MD5.New())
+			},
+			parameter: "hash",
+		},
+		{
+			name: "strategy",
+			other: func() (bloom.Filter, error) {
+				return bloom.New(crypto.MD5.New())
+			},
+			parameter: "strategy",
+		},
+		{
+			name: "type",
+			other: func() (bloom.Filter, error) {
+				return bloom.NewCounting(10000, 0.01)
+			},
+			parameter: "type",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := bloom.NewDoubleHashing(10000, 0.01)
+			require.NoError(t, err)
+			other, err := tt.other()
+			require.NoError(t, err)
+
+			for _, err := range []error{filter.Union(other), filter.Intersect(other)} {
+				assert.ErrorIs(t, err, bloom.ErrIncompatible)
+
+				var incompatible *bloom.IncompatibleError
+				require.True(t, errors.As(err, &incompatible))
+				assert.Equal(t, tt.parameter, incompatible.Parameter)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package bloom
+
+import (
+	"hash"
+	"sync"
+	"sync/atomic"
+
+	"github.com/twmb/murmur3"
+)
+
+// check interface implementation
+var _ Filter = &concurrentFilter{}
+
+// concurrentFilter is a lock-free double hashing filter: bits are stored in 64 bits words
+// set with compare-and-swap and each call use its own hasher from a pool.
+type concurrentFilter struct {
+	hashers sync.Pool // of *hasher
+	bits    []uint64
+	m       uint64
+	k       uint64
+	count   atomic.Uint64
+}
+
+// hasher is a hash with a reusable output buffer.
+type hasher struct {
+	hash hash.Hash
+	buf  []byte
+}
+
+// NewConcurrent create a filter sized like NewDoubleHashing safe for concurrent use without lock.
+// newHash is called for each hasher added to the pool, without it a 128 bits murmur3 is used.
+func NewConcurrent(n uint64, fpRate float64, newHash func() hash.Hash) (*concurrentFilter, error) {
+	if newHash == nil {
+		newHash = func() hash.Hash { return murmur3.New128() }
+	}
+
+	h, m, k, err := estimate(strategyDoubleHashing, n, fpRate, newHash())
+	if err != nil {
+		return nil, err
+	}
+
+	f := &concurrentFilter{
+		bits: make([]uint64, bitsToBytes(m)/8),
+		m:    m,
+		k:    k,
+	}
+	f.hashers.New = func() any {
+		h := newHash()
+		return &hasher{hash: h, buf: make([]byte, 0, h.Size())}
+	}
+	f.hashers.Put(&hasher{hash: h, buf: make([]byte, 0, h.Size())})
+
+	return f, nil
+}
+
+// positions hash b and append its positions to dst.
+func (f *concurrentFilter) positions(dst []uint64, b []byte) []uint64 {
+	h := f.hashers.Get().(*hasher)
+	h.hash.Write(b)
+	h.buf = h.hash.Sum(h.buf[:0])
+	h.hash.Reset()
+
+	dst = strategyDoubleHashing.positions(dst, h.buf, f.m, f.k)
+	f.hashers.Put(h)
+
+	return dst
+}
+
+func (f *concurrentFilter) Add(b []byte) {
+	var buf [maxStackPositions]uint64
+	f.add(f.positions(buf[:0], b))
+}
+
+func (f *concurrentFilter) AddFingerprint(fp []byte) {
+	var buf [maxStackPositions]uint64
+	f.add(strategyDoubleHashing.positions(buf[:0], fp, f.m, f.k))
+}
+
+func (f *concurrentFilter) add(positions []uint64) {
+	f.count.Add(1)
+	for _, pos := range positions {
+		word, mask := &f.bits[pos/64], uint64(1)<<(pos%64)
+		for {
+			old := atomic.LoadUint64(word)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+func (f *concurrentFilter) Contain(b []byte) bool {
+	var buf [maxStackPositions]uint64
+	return f.contain(f.positions(buf[:0], b))
+}
+
+func (f *concurrentFilter) ContainFingerprint(fp []byte) bool {
+	var buf [maxStackPositions]uint64
+	return f.contain(strategyDoubleHashing.positions(buf[:0], fp, f.m, f.k))
+}
+
+func (f *concurrentFilter) contain(positions []uint64) bool {
+	for _, pos := range positions {
+		if atomic.LoadUint64(&f.bits[pos/64])&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ByteSize return the memory used by the filter bits.
+func (f *concurrentFilter) ByteSize() uint64 {
+	return uint64(len(f.bits)) * 8
+}
@@ -0,0 +1,131 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"fmt"
+	"hash"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		newHash func() hash.Hash
+	}{
+		{
+			name: "Murmur3_128",
+		},
+		{
+			name:    "SHA256",
+			newHash: crypto.SHA256.New,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := 100000
+			filter, err := bloom.NewConcurrent(uint64(n), 0.01, tt.newHash)
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			workers := 8
+			wg.Add(workers)
+			for w := 0; w < workers; w++ {
+				w := w
+				go func() {
+					defer wg.Done()
+					for i := w; i < n; i += workers {
+						filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+						// read while others write
+						filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", n+i)))
+					}
+				}()
+			}
+			wg.Wait()
+
+			for i := 0; i < n; i++ {
+				require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+			falsePositive := 0
+			for i := n; i < 2*n; i++ {
+				if filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))) {
+					falsePositive++
+				}
+			}
+			assert.Less(t, float64(falsePositive)/float64(n), 0.012, "false positive rate")
+		})
+	}
+
+	t.Run("SameBitsAsDoubleHashing", func(t *testing.T) {
+		filter, err := bloom.NewConcurrent(1000, 0.01, nil)
+		require.NoError(t, err)
+		plain, err := bloom.NewDoubleHashing(1000, 0.01)
+		require.NoError(t, err)
+
+		filter.Add([]byte("https://example.com/"))
+		plain.Add([]byte("https://example.com/"))
+		assert.Equal(t, plain.ByteSize(), filter.ByteSize())
+		assert.True(t, plain.Contain([]byte("https://example.com/")))
+		assert.True(t, filter.Contain([]byte("https://example.com/")))
+	})
+}
+
+func BenchmarkConcurrentFilter(b *testing.B) {
+	n := uint64(1000000)
+	objects := make([][]byte, 0, 1024)
+	for i := 0; i < cap(objects); i++ {
+		objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+
+	for name, newFilter := range map[string]func() (bloom.Filter, error){
+		"Concurrent": func() (bloom.Filter, error) {
+			return bloom.NewConcurrent(n, 0.01, nil)
+		},
+		"DoubleHashing": func() (bloom.Filter, error) {
+			return bloom.NewDoubleHashing(n, 0.01)
+		},
+	} {
+		newFilter := newFilter
+		b.Run(name, func(b *testing.B) {
+			b.Run("Add", func(b *testing.B) {
+				filter, err := newFilter()
+				require.NoError(b, err)
+				var worker atomic.Uint64
+
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					i := worker.Add(1) * 97 // spread workers over objects
+					for pb.Next() {
+						filter.Add(objects[i%uint64(len(objects))])
+						i++
+					}
+				})
+			})
+
+			b.Run("Contain", func(b *testing.B) {
+				filter, err := newFilter()
+				require.NoError(b, err)
+				for _, o := range objects[:len(objects)/2] {
+					filter.Add(o)
+				}
+				var worker atomic.Uint64
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := worker.Add(1) * 97 // spread workers over objects
+					for pb.Next() {
+						filter.Contain(objects[i%uint64(len(objects))])
+						i++
+					}
+				})
+			})
+		})
+	}
+}
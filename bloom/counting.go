@@ -0,0 +1,134 @@
+package bloom
+
+import (
+	"hash"
+	"sync"
+)
+
+// check interface implementation
+var _ Filter = &countingFilter{}
+
+// counterMax is the saturation value of 4 bits counters.
+const counterMax = 0x0f
+
+// countingFilter is a bloom filter using 4 bits counters instead of bits so objects can be removed.
+// A counter reaching counterMax is saturated: it is never decremented again as the real count is lost.
+type countingFilter struct {
+	mu       sync.RWMutex
+	hash     hash.Hash
+	counters []byte // two 4 bits counters by byte, even positions use the low nibble
+	strategy strategy
+	m        uint64
+	k        uint64
+	count    uint64
+}
+
+// NewCounting create a counting filter sized to hold n objects with at most a fpRate false positive rate.
+// Positions are derived like NewDoubleHashing and it use 4 times the memory of the equivalent filter.
+func NewCounting(n uint64, fpRate float64, hashList ...hash.Hash) (*countingFilter, error) {
+	hash, m, k, err := estimate(strategyDoubleHashing, n, fpRate, hashList...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingFilter{
+		hash:     hash,
+		counters: make([]byte, (m+1)/2),
+		strategy: strategyDoubleHashing,
+		m:        m,
+		k:        k,
+	}, nil
+}
+
+func (f *countingFilter) hashBytes(b []byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hash.Write(b)
+	fp := f.hash.Sum(nil)
+	f.hash.Reset()
+
+	return fp
+}
+
+func (f *countingFilter) Add(b []byte) {
+	f.AddFingerprint(f.hashBytes(b))
+}
+
+func (f *countingFilter) AddFingerprint(fp []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.count++
+	var buf [maxStackPositions]uint64
+	for _, pos := range f.strategy.positions(buf[:0], fp, f.m, f.k) {
+		if c := f.counter(pos); c < counterMax {
+			f.setCounter(pos, c+1)
+		}
+	}
+}
+
+func (f *countingFilter) Contain(b []byte) bool {
+	return f.ContainFingerprint(f.hashBytes(b))
+}
+
+func (f *countingFilter) ContainFingerprint(fp []byte) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.contain(fp)
+}
+
+// Remove object from filter, it return false if object was not in filter.
+// Only remove objects previously added or other objects could become false negative.
+func (f *countingFilter) Remove(b []byte) bool {
+	return f.RemoveFingerprint(f.hashBytes(b))
+}
+
+// RemoveFingerprint directly remove hash result if already available.
+func (f *countingFilter) RemoveFingerprint(fp []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.contain(fp) {
+		return false
+	}
+
+	f.count--
+	var buf [maxStackPositions]uint64
+	for _, pos := range f.strategy.positions(buf[:0], fp, f.m, f.k) {
+		if c := f.counter(pos); c < counterMax {
+			f.setCounter(pos, c-1)
+		}
+	}
+
+	return true
+}
+
+// ByteSize return the memory used by the counters.
+func (f *countingFilter) ByteSize() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return uint64(len(f.counters))
+}
+
+func (f *countingFilter) contain(fp []byte) bool {
+	var buf [maxStackPositions]uint64
+	for _, pos := range f.strategy.positions(buf[:0], fp, f.m, f.k) {
+		if f.counter(pos) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *countingFilter) counter(pos uint64) byte {
+	return f.counters[pos/2] >> (4 * (pos % 2)) & 0x0f
+}
+
+func (f *countingFilter) setCounter(pos uint64, c byte) {
+	shift := 4 * (pos % 2)
+	f.counters[pos/2] = f.counters[pos/2]&^(0x0f<<shift) | c<<shift
+}
@@ -0,0 +1,100 @@
+package bloom_test
+
+import (
+	"bloom"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountingFilter(t *testing.T) {
+	n := uint64(10000)
+	filter, err := bloom.NewCounting(n, 0.01)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < n; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	for i := uint64(0); i < n; i++ {
+		require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+	}
+
+	// remove half of objects
+	for i := uint64(0); i < n; i += 2 {
+		require.True(t, filter.Remove([]byte(fmt.Sprintf("https://example.com/%d", i))), "remove")
+	}
+	falsePositive := 0
+	for i := uint64(0); i < n; i++ {
+		contain := filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i)))
+		if i%2 == 1 {
+			require.True(t, contain, "false negative after remove")
+		} else if contain {
+			falsePositive++
+		}
+	}
+	assert.Less(t, float64(falsePositive)/float64(n/2), 0.01, "false positive rate")
+
+	t.Run("RemoveMissing", func(t *testing.T) {
+		assert.False(t, filter.Remove([]byte("https://example.com/missing")))
+	})
+
+	t.Run("Saturation", func(t *testing.T) {
+		filter, err := bloom.NewCounting(100, 0.01)
+		require.NoError(t, err)
+
+		object := []byte("https://example.com/")
+		for i := 0; i < 20; i++ {
+			filter.Add(object)
+		}
+		for i := 0; i < 20; i++ {
+			filter.Remove(object)
+		}
+		// saturated counters are never decremented
+		assert.True(t, filter.Contain(object))
+	})
+
+	t.Run("ByteSize", func(t *testing.T) {
+		plain, err := bloom.NewDoubleHashing(n, 0.01)
+		require.NoError(t, err)
+
+		assert.InDelta(t, 4*plain.ByteSize(), filter.ByteSize(), 32)
+	})
+}
+
+func BenchmarkCountingFilter(b *testing.B) {
+	b.Run("Add", func(b *testing.B) {
+		filter, err := bloom.NewCounting(uint64(b.N), 0.01)
+		require.NoError(b, err)
+
+		objects := make([][]byte, 0, b.N)
+		for i := 0; i < b.N; i++ {
+			objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+		}
+		b.ResetTimer()
+
+		for _, o := range objects {
+			filter.Add(o)
+		}
+		b.ReportMetric(float64(filter.ByteSize()), "B")
+	})
+
+	b.Run("Remove", func(b *testing.B) {
+		filter, err := bloom.NewCounting(uint64(b.N), 0.01)
+		require.NoError(b, err)
+
+		objects := make([][]byte, 0, b.N)
+		for i := 0; i < b.N; i++ {
+			objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+		}
+		for _, o := range objects {
+			filter.Add(o)
+		}
+		b.ResetTimer()
+
+		for _, o := range objects {
+			filter.Remove(o)
+		}
+	})
+}
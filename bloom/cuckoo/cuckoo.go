@@ -0,0 +1,306 @@
+package cuckoo
+
+import (
+	"bloom"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// check interface implementation
+var _ bloom.Filter = &CuckooFilter{}
+
+var (
+	ErrInvalidEstimates = bloom.ErrInvalidEstimates
+	ErrHashTooShort     = bloom.ErrHashTooShort
+	ErrFull             = errors.New("cuckoo filter is full")
+)
+
+// BucketSize is the number of fingerprints by bucket.
+const BucketSize = 4
+
+const (
+	// maxLoadFactor is the load a filter with 4 entries buckets can reach before inserts start failing.
+	maxLoadFactor = 0.95
+	// maxKicks is the number of relocations tried before declaring the filter full.
+	maxKicks = 500
+	// maxFingerprintBits is the maximum size of stored fingerprints.
+	maxFingerprintBits = 16
+)
+
+// CuckooFilter is a cuckoo filter (Fan et al.) with buckets of 4 fingerprints and partial-key cuckoo hashing:
+// an object can be in bucket i1 or i2 = i1 ^ hash(fingerprint) so it can be moved without the original object.
+// Unlike a bloom filter objects can be deleted. Fingerprints are packed on the f bits needed by the false positive rate,
+// at full load it use less space than a bloom filter for rates under ~0.2% but buckets are rounded to a power of 2.
+type CuckooFilter struct {
+	mu      sync.RWMutex
+	hash    hash.Hash
+	table   []byte // BucketSize fingerprints of fpBits by bucket, 0 is an empty entry
+	entries uint64
+	mask    uint64 // number of buckets - 1, a power of 2 so i1 and i2 are symmetric
+	fpBits  uint64
+	fpMask  uint16
+	count   uint64
+	// victim keep the fingerprint evicted by the last failed insert so no object is lost.
+	victim      uint16
+	victimIndex uint64
+	hasVictim   bool
+	// rand state used to pick entries to kick.
+	rand uint64
+}
+
+// New create a cuckoo filter sized to hold n objects with at most a fpRate false positive rate.
+// Without hash a 128 bits murmur3 is used, hash should produce at least 16 bytes.
+func New(n uint64, fpRate float64, hashList ...hash.Hash) (*CuckooFilter, error) {
+	if n == 0 || !(fpRate > 0 && fpRate < 1) {
+		return nil, fmt.Errorf("%w: n=%d fpRate=%f", ErrInvalidEstimates, n, fpRate)
+	}
+
+	// a lookup compare 2 buckets of fingerprints: fpRate ~= 2*BucketSize / 2^f
+	f := uint(math.Ceil(math.Log2(2 * BucketSize / fpRate)))
+	if f > maxFingerprintBits {
+		return nil, fmt.Errorf("%w: fpRate=%f need %d bits fingerprints, max is %d", ErrInvalidEstimates, fpRate, f, maxFingerprintBits)
+	}
+
+	buckets := uint64(math.Ceil(float64(n) / BucketSize / maxLoadFactor))
+	buckets = 1 << bits.Len64(buckets-1) // round to power of 2
+
+	hash, err := bloom.GroupHash(hashList...)
+	if err != nil {
+		return nil, err
+	}
+	if hash.Size() < 16 {
+		return nil, fmt.Errorf("%w: need 16 bytes, hash only produce %d", ErrHashTooShort, hash.Size())
+	}
+
+	entries := buckets * BucketSize
+	return &CuckooFilter{
+		hash:    hash,
+		table:   make([]byte, (entries*uint64(f)+7)/8+2), // padding to always access 3 bytes
+		entries: entries,
+		mask:    buckets - 1,
+		fpBits:  uint64(f),
+		fpMask:  uint16(1<<f - 1),
+		rand:    0x9e3779b97f4a7c15,
+	}, nil
+}
+
+func (c *CuckooFilter) hashBytes(b []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hash.Write(b)
+	fp := c.hash.Sum(nil)
+	c.hash.Reset()
+
+	return fp
+}
+
+// split return the first bucket and the stored fingerprint of a hash result.
+func (c *CuckooFilter) split(fp []byte) (uint64, uint16) {
+	i := binary.BigEndian.Uint64(fp) & c.mask
+	f := uint16(binary.BigEndian.Uint64(fp[8:])) & c.fpMask
+	if f == 0 { // 0 mark empty entries
+		f = 1
+	}
+
+	return i, f
+}
+
+// altIndex return the other bucket of fingerprint f stored in bucket i.
+func (c *CuckooFilter) altIndex(i uint64, f uint16) uint64 {
+	return (i ^ bloom.Mix64(uint64(f))) & c.mask
+}
+
+// Add object to filter, use Insert to know if the filter is full.
+func (c *CuckooFilter) Add(b []byte) {
+	_ = c.Insert(b)
+}
+
+// AddFingerprint directly add hash result if already available, use InsertFingerprint to know if the filter is full.
+func (c *CuckooFilter) AddFingerprint(fp []byte) {
+	_ = c.InsertFingerprint(fp)
+}
+
+// Insert object to filter, it return ErrFull when no room could be made for it.
+func (c *CuckooFilter) Insert(b []byte) error {
+	return c.InsertFingerprint(c.hashBytes(b))
+}
+
+// InsertFingerprint directly insert hash result if already available.
+func (c *CuckooFilter) InsertFingerprint(fp []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hasVictim {
+		return ErrFull
+	}
+
+	i1, f := c.split(fp)
+	c.count++ // the object is stored even if the filter is full
+	if !c.place(i1, f) {
+		return ErrFull
+	}
+
+	return nil
+}
+
+// place store f in bucket i or its alternate, kicking existing fingerprints to their alternate bucket
+// when both are full. It return false when the last kicked fingerprint had to be kept as victim.
+func (c *CuckooFilter) place(i uint64, f uint16) bool {
+	alt := c.altIndex(i, f)
+	if c.insert(i, f) || c.insert(alt, f) {
+		return true
+	}
+
+	if c.next()&1 == 1 {
+		i = alt
+	}
+	for kick := 0; kick < maxKicks; kick++ {
+		entry := i*BucketSize + c.next()%BucketSize
+		kicked := c.get(entry)
+		c.set(entry, f)
+		f = kicked
+
+		i = c.altIndex(i, f)
+		if c.insert(i, f) {
+			return true
+		}
+	}
+
+	c.victim, c.victimIndex, c.hasVictim = f, i, true
+
+	return false
+}
+
+// insert store f in a free entry of bucket i.
+func (c *CuckooFilter) insert(i uint64, f uint16) bool {
+	for entry := i * BucketSize; entry < (i+1)*BucketSize; entry++ {
+		if c.get(entry) == 0 {
+			c.set(entry, f)
+			return true
+		}
+	}
+
+	return false
+}
+
+// get return the fingerprint stored in entry.
+func (c *CuckooFilter) get(entry uint64) uint16 {
+	bit := entry * c.fpBits
+	b := c.table[bit/8 : bit/8+3]
+	v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+
+	return uint16(v>>(bit%8)) & c.fpMask
+}
+
+// set store fingerprint f in entry.
+func (c *CuckooFilter) set(entry uint64, f uint16) {
+	bit := entry * c.fpBits
+	shift := bit % 8
+	b := c.table[bit/8 : bit/8+3]
+	v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	v = v&^(uint32(c.fpMask)<<shift) | uint32(f)<<shift
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func (c *CuckooFilter) Contain(b []byte) bool {
+	return c.ContainFingerprint(c.hashBytes(b))
+}
+
+func (c *CuckooFilter) ContainFingerprint(fp []byte) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i1, f := c.split(fp)
+	i2 := c.altIndex(i1, f)
+	if c.hasVictim && c.victim == f && (c.victimIndex == i1 || c.victimIndex == i2) {
+		return true
+	}
+
+	return c.find(i1, f) >= 0 || c.find(i2, f) >= 0
+}
+
+// find return the entry of f in bucket i or -1.
+func (c *CuckooFilter) find(i uint64, f uint16) int64 {
+	for entry := i * BucketSize; entry < (i+1)*BucketSize; entry++ {
+		if c.get(entry) == f {
+			return int64(entry)
+		}
+	}
+
+	return -1
+}
+
+// Delete object from filter, it return false if object was not in filter.
+// Only delete objects previously added or other objects could become false negative.
+func (c *CuckooFilter) Delete(b []byte) bool {
+	return c.DeleteFingerprint(c.hashBytes(b))
+}
+
+// DeleteFingerprint directly delete hash result if already available.
+func (c *CuckooFilter) DeleteFingerprint(fp []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i1, f := c.split(fp)
+	i2 := c.altIndex(i1, f)
+
+	switch {
+	case c.hasVictim && c.victim == f && (c.victimIndex == i1 || c.victimIndex == i2):
+		c.hasVictim = false
+	case c.find(i1, f) >= 0:
+		c.set(uint64(c.find(i1, f)), 0)
+	case c.find(i2, f) >= 0:
+		c.set(uint64(c.find(i2, f)), 0)
+	default:
+		return false
+	}
+	c.count--
+
+	// room was made, try to store the victim back
+	if c.hasVictim {
+		c.hasVictim = false
+		c.place(c.victimIndex, c.victim)
+	}
+
+	return true
+}
+
+// Count return the number of objects in filter.
+func (c *CuckooFilter) Count() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.count
+}
+
+// LoadFactor return the ratio of used entries.
+func (c *CuckooFilter) LoadFactor() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return float64(c.count) / float64(c.entries)
+}
+
+// FingerprintBits return the size of stored fingerprints, picked by New from the false positive rate.
+func (c *CuckooFilter) FingerprintBits() uint {
+	return uint(c.fpBits)
+}
+
+// ByteSize return the memory used by the buckets.
+func (c *CuckooFilter) ByteSize() uint64 {
+	return uint64(len(c.table))
+}
+
+// next return a pseudo random number (xorshift64).
+func (c *CuckooFilter) next() uint64 {
+	c.rand ^= c.rand << 13
+	c.rand ^= c.rand >> 7
+	c.rand ^= c.rand << 17
+	return c.rand
+}
@@ -0,0 +1,225 @@
+package cuckoo_test
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bloom"
+	"bloom/cuckoo"
+
+	_ "crypto/md5"
+)
+
+func TestCuckooFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        uint64
+		fpRate   float64
+		hashList []hash.Hash
+		wantSize uint64
+		wantBits uint
+		wantErr  error
+	}{
+		{
+			name:    "zero",
+			fpRate:  0.01,
+			wantErr: cuckoo.ErrInvalidEstimates,
+		},
+		{
+			name:    "fpRate too low",
+			n:       1000,
+			fpRate:  0.00001,
+			wantErr: cuckoo.ErrInvalidEstimates,
+		},
+		{
+			name:   "FNV64 too short",
+			n:      1000,
+			fpRate: 0.01,
+			hashList: []hash.Hash{
+				fnv.New64a(),
+			},
+			wantErr: cuckoo.ErrHashTooShort,
+		},
+		{
+			name:     "Murmur3_128/1%",
+			n:        100000,
+			fpRate:   0.01,
+			wantSize: 163842,
+			wantBits: 10,
+		},
+		{
+			name:     "Murmur3_128/0.1%",
+			n:        100000,
+			fpRate:   0.001,
+			wantSize: 212994,
+			wantBits: 13,
+		},
+		{
+			name:   "MD5/1%",
+			n:      100000,
+			fpRate: 0.01,
+			hashList: []hash.Hash{
+				crypto.MD5.New(),
+			},
+			wantSize: 163842,
+			wantBits: 10,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := cuckoo.New(tt.n, tt.fpRate, tt.hashList...)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSize, filter.ByteSize(), "size")
+			assert.Equal(t, tt.wantBits, filter.FingerprintBits(), "fingerprint bits")
+
+			for i := uint64(0); i < tt.n; i++ {
+				require.NoError(t, filter.Insert([]byte(fmt.Sprintf("https://example.com/%d", i))))
+			}
+			assert.Equal(t, tt.n, filter.Count())
+			for i := uint64(0); i < tt.n; i++ {
+				require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+
+			falsePositive := 0
+			for i := tt.n; i < 2*tt.n; i++ {
+				if filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))) {
+					falsePositive++
+				}
+			}
+			assert.Less(t, float64(falsePositive)/float64(tt.n), tt.fpRate, "false positive rate")
+
+			// delete half of objects
+			for i := uint64(0); i < tt.n; i += 2 {
+				require.True(t, filter.Delete([]byte(fmt.Sprintf("https://example.com/%d", i))), "delete")
+			}
+			assert.Equal(t, tt.n/2, filter.Count())
+			for i := uint64(1); i < tt.n; i += 2 {
+				require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative after delete")
+			}
+		})
+	}
+}
+
+func TestCuckooFilterBloomErrors(t *testing.T) {
+	// errors are shared with the bloom package
+	_, err := cuckoo.New(0, 0.01)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+	_, err = cuckoo.New(1000, 0.01, fnv.New64a())
+	assert.ErrorIs(t, err, bloom.ErrHashTooShort)
+}
+
+func TestCuckooFilterFull(t *testing.T) {
+	filter, err := cuckoo.New(100, 0.01)
+	require.NoError(t, err)
+
+	var inserted []int
+	var fullErr error
+	for i := 0; i < 1000 && fullErr == nil; i++ {
+		fullErr = filter.Insert([]byte(fmt.Sprintf("https://example.com/%d", i)))
+		inserted = append(inserted, i) // the object failing insert is kept aside
+	}
+	require.ErrorIs(t, fullErr, cuckoo.ErrFull)
+	assert.Greater(t, filter.LoadFactor(), 0.9)
+
+	// next inserts keep failing
+	assert.True(t, errors.Is(filter.Insert([]byte("https://example.com/more")), cuckoo.ErrFull))
+
+	// no object is lost
+	for _, i := range inserted {
+		require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+	}
+
+	// making room accept inserts again
+	for _, i := range inserted[:len(inserted)/2] {
+		require.True(t, filter.Delete([]byte(fmt.Sprintf("https://example.com/%d", i))))
+	}
+	assert.NoError(t, filter.Insert([]byte("https://example.com/more")))
+	for _, i := range inserted[len(inserted)/2:] {
+		require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+	}
+}
+
+func TestCuckooFilterDeleteMissing(t *testing.T) {
+	filter, err := cuckoo.New(100, 0.01)
+	require.NoError(t, err)
+
+	filter.Add([]byte("https://example.com/"))
+	assert.False(t, filter.Delete([]byte("https://example.com/missing")))
+	assert.True(t, filter.Delete([]byte("https://example.com/")))
+	assert.False(t, filter.Contain([]byte("https://example.com/")))
+}
+
+func BenchmarkCuckooFilter(b *testing.B) {
+	for _, fpRate := range []float64{0.01, 0.001} {
+		fpRate := fpRate
+		b.Run(fmt.Sprint(fpRate), func(b *testing.B) {
+			for name, newFilter := range map[string]func(n uint64) (sizedFilter, error){
+				"Cuckoo": func(n uint64) (sizedFilter, error) {
+					return cuckoo.New(n, fpRate)
+				},
+				"Bloom-DoubleHashing": func(n uint64) (sizedFilter, error) {
+					return bloom.NewDoubleHashing(n, fpRate)
+				},
+			} {
+				newFilter := newFilter
+				b.Run(name, func(b *testing.B) {
+					b.Run("Add", func(b *testing.B) {
+						filter, err := newFilter(uint64(b.N))
+						require.NoError(b, err)
+
+						objects := make([][]byte, 0, b.N)
+						for i := 0; i < b.N; i++ {
+							objects = append(objects, []byte(fmt.Sprintf("https://example.com/%d", i)))
+						}
+						b.ResetTimer()
+
+						for _, o := range objects {
+							filter.Add(o)
+						}
+						b.ReportMetric(float64(filter.ByteSize())/float64(b.N), "B/object")
+					})
+
+					b.Run("Contain", func(b *testing.B) {
+						nbObjectInFilter := 100000
+						filter, err := newFilter(uint64(nbObjectInFilter))
+						require.NoError(b, err)
+						for i := 0; i < nbObjectInFilter; i++ {
+							filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+						}
+						missing_objects := make([][]byte, 0, b.N)
+						for i := 0; i < b.N; i++ {
+							missing_objects = append(missing_objects, []byte(fmt.Sprintf("https://example.com/%d", nbObjectInFilter+i)))
+						}
+						b.ResetTimer()
+
+						false_positive := float64(0)
+						for _, o := range missing_objects {
+							if filter.Contain(o) {
+								false_positive++
+							}
+						}
+						b.ReportMetric(100*false_positive/float64(b.N), "%fp")
+					})
+				})
+			}
+		})
+	}
+}
+
+// sizedFilter is a bloom.Filter reporting its memory use.
+type sizedFilter interface {
+	bloom.Filter
+	ByteSize() uint64
+}
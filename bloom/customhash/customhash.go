@@ -1,7 +1,6 @@
 package customhash
 
 import (
-	"bytes"
 	"crypto"
 	"errors"
 	"hash"
@@ -63,11 +62,10 @@ func (ch *CustomHash) Write(p []byte) (n int, err error) {
 // Sum appends the current hash to b and returns the resulting slice.
 // It does not change the underlying hash state.
 func (ch *CustomHash) Sum(b []byte) []byte {
-	byteList := make([][]byte, len(ch.hash))
-	for i := range byteList {
-		byteList[i] = ch.hash[i].Sum(b)
+	for _, h := range ch.hash {
+		b = h.Sum(b)
 	}
-	return bytes.Join(byteList, nil)
+	return b
 }
 
 // Reset resets the Hash to its initial state.
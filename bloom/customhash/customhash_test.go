@@ -102,6 +102,18 @@ func TestCustomHash(t *testing.T) {
 	}
 }
 
+func TestCustomHashSumAppend(t *testing.T) {
+	h, err := customhash.New(crypto.BLAKE2b_256, [][]byte{nil, []byte("3dbUhg7x")})
+	require.NoError(t, err)
+	h.Write([]byte("some_random_string"))
+
+	sum := h.Sum(nil)
+	prefix := []byte("prefix")
+	buf := make([]byte, len(prefix), 128) // spare capacity must not be shared by hashes
+	copy(buf, prefix)
+	assert.Equal(t, append(prefix, sum...), h.Sum(buf))
+}
+
 func BenchmarkCustomHash(b *testing.B) {
 
 	tests := []struct {
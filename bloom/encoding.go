@@ -0,0 +1,386 @@
+package bloom
+
+import (
+	"bloom/hashspec"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+)
+
+// check interface implementation
+var (
+	_ encoding.BinaryMarshaler   = &filter{}
+	_ encoding.BinaryUnmarshaler = &filter{}
+	_ io.WriterTo                = &filter{}
+	_ io.ReaderFrom              = &filter{}
+)
+
+var (
+	ErrInvalidFormat      = errors.New("invalid format")
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	ErrChecksum           = errors.New("checksum mismatch")
+	ErrHashMismatch       = errors.New("hash configuration mismatch")
+	ErrMissingSpec        = errors.New("missing hash spec")
+)
+
+const (
+	// formatVersion is the current version of binary representation.
+	formatVersion = 1
+	// formatVersionSpec is formatVersion followed by the hash spec, used by filters built from a hash spec.
+	formatVersionSpec = 2
+	// maxSpecSize is the size limit of an embedded hash spec.
+	maxSpecSize = math.MaxUint16
+	// headerSize is the size of magic, version, strategy, hashID, m, k and count.
+	headerSize = 4 + 1 + 1 + 8 + 8 + 8 + 8
+	// checksumSize is the size of the trailing crc32.
+	checksumSize = 4
+	// maxBits bound the number of bits of a loaded filter, 128 GiB.
+	maxBits = 1 << 40
+	// readChunkSize is the first allocation reading bits, the buffer then grow as data arrive.
+	readChunkSize = 1 << 20
+)
+
+var (
+	magic = [4]byte{'B', 'L', 'M', 'F'}
+	// hashProbe is hashed to identify a hash configuration.
+	hashProbe = []byte("bloom hash configuration probe")
+	crcTable  = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// HashID identify a hash configuration by hashing a constant probe,
+// different algorithms or salts produce different identifiers.
+func HashID(h hash.Hash) uint64 {
+	h.Write(hashProbe)
+	fp := h.Sum(nil)
+	h.Reset()
+
+	id := fnv.New64a()
+	id.Write(fp)
+	return id.Sum64()
+}
+
+// MarshalBinary encode the filter with its configuration, see WriteTo for the layout.
+func (f *filter) MarshalBinary() ([]byte, error) {
+	f.mu.RLock()
+	size := headerSize + 2 + len(f.spec) + len(f.fingerprint) + checksumSize
+	f.mu.RUnlock()
+
+	return marshalBinary(f, size)
+}
+
+// UnmarshalBinary load a filter encoded by MarshalBinary.
+// The filter should have been created with the same hash configuration.
+func (f *filter) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(f, data)
+}
+
+// BinaryFilter is a Filter that can be saved and loaded.
+type BinaryFilter interface {
+	Filter
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// NewFromBinary create a filter encoded by MarshalBinary, its hash is rebuilt from the embedded hash spec
+// so the filter should have been created with a hashspec.Hash. Dense, sparse and scalable filters are detected
+// from their magic, a sparse filter saved once dense is loaded as a dense one.
+func NewFromBinary(data []byte) (BinaryFilter, error) {
+	if len(data) < 5 {
+		return nil, ErrInvalidFormat
+	}
+
+	switch {
+	case bytes.Equal(data[:4], magic[:]):
+		return newFilterFromBinary(data)
+	case bytes.Equal(data[:4], sparseMagic[:]):
+		return newSparseFromBinary(data)
+	case bytes.Equal(data[:4], scalableMagic[:]):
+		return newScalableFromBinary(data)
+	}
+
+	return nil, ErrInvalidFormat
+}
+
+// newFilterFromBinary create a filter encoded by filter.MarshalBinary from its hash spec.
+func newFilterFromBinary(data []byte) (*filter, error) {
+	if len(data) < headerSize {
+		return nil, ErrInvalidFormat
+	}
+	hash, err := specHash(data, headerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s := strategy(data[5])
+	m := binary.BigEndian.Uint64(data[14:])
+	k := binary.BigEndian.Uint64(data[22:])
+	f := newFilterWithBits(hash, s, m, k, nil)
+	if err := f.validate(m, k); err != nil {
+		return nil, err
+	}
+	if err := f.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// specHash build the hash of data encoded with the version in data[4], its spec starting at data[offset:].
+func specHash(data []byte, offset int) (*hashspec.Hash, error) {
+	switch data[4] {
+	case formatVersionSpec:
+	case formatVersion:
+		return nil, ErrMissingSpec
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[4])
+	}
+	if len(data) < offset {
+		return nil, ErrInvalidFormat
+	}
+
+	spec, err := readSpec(bytes.NewReader(data[offset:]))
+	if err != nil {
+		return nil, err
+	}
+	return hashspec.New(spec)
+}
+
+// WriteTo stream the filter with its configuration to w.
+//
+// Layout (big endian):
+//
+//	magic "BLMF" | version uint8 | strategy uint8 | hashID uint64 | m uint64 | k uint64 | count uint64 | bits | crc32c
+//
+// Filters created with a hashspec.Hash are version 2 and embed their hash spec after the header:
+//
+//	... | count uint64 | spec length uint16 | spec | bits | crc32c
+func (f *filter) WriteTo(w io.Writer) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var header [headerSize]byte
+	f.putHeader(header[:], magic)
+
+	var spec []byte
+	if f.spec != "" {
+		header[4] = formatVersionSpec
+		var err error
+		if spec, err = appendSpec(nil, f.spec); err != nil {
+			return 0, err
+		}
+	}
+
+	crc := crc32.New(crcTable)
+	mw := io.MultiWriter(w, crc)
+
+	var written int64
+	for _, b := range [][]byte{header[:], spec, f.fingerprint} {
+		n, err := mw.Write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	var sum [checksumSize]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	n, err := w.Write(sum[:])
+	written += int64(n)
+
+	return written, err
+}
+
+// putHeader write magicNumber and the filter configuration in the first headerSize bytes of b, f.mu should be held.
+func (f *filter) putHeader(b []byte, magicNumber [4]byte) {
+	copy(b, magicNumber[:])
+	b[4] = formatVersion
+	b[5] = byte(f.strategy)
+	binary.BigEndian.PutUint64(b[6:], f.hashID)
+	binary.BigEndian.PutUint64(b[14:], f.m)
+	binary.BigEndian.PutUint64(b[22:], f.k)
+	binary.BigEndian.PutUint64(b[30:], f.count)
+}
+
+// ReadFrom load a filter streamed by WriteTo from r.
+// The filter should have been created with the same hash configuration.
+// Bits are read directly in the new filter array and the filter is only updated once the checksum is verified.
+func (f *filter) ReadFrom(r io.Reader) (int64, error) {
+	crc := crc32.New(crcTable)
+	cr := &countReader{r: io.TeeReader(r, crc)}
+
+	var header [headerSize]byte
+	if _, err := io.ReadFull(cr, header[:]); err != nil {
+		return cr.n, readError(err)
+	}
+	if !bytes.Equal(header[:4], magic[:]) {
+		return cr.n, ErrInvalidFormat
+	}
+	if header[4] != formatVersion && header[4] != formatVersionSpec {
+		return cr.n, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header[4])
+	}
+
+	s := strategy(header[5])
+	id := binary.BigEndian.Uint64(header[6:])
+	m := binary.BigEndian.Uint64(header[14:])
+	k := binary.BigEndian.Uint64(header[22:])
+	count := binary.BigEndian.Uint64(header[30:])
+
+	// the spec only describe the hash, already identified by hashID
+	if header[4] == formatVersionSpec {
+		if _, err := readSpec(cr); err != nil {
+			return cr.n, err
+		}
+	}
+
+	// strategy, hash and hashID never change after creation
+	if s != f.strategy || id != f.hashID {
+		return cr.n, ErrHashMismatch
+	}
+	if err := f.validate(m, k); err != nil {
+		return cr.n, err
+	}
+
+	// m is not trusted yet, never allocate much more than what is read
+	bits, err := readBits(cr, s.size(m))
+	if err != nil {
+		return cr.n, err
+	}
+	expected := crc.Sum32()
+
+	var sum [checksumSize]byte
+	if _, err := io.ReadFull(cr, sum[:]); err != nil {
+		return cr.n, readError(err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != expected {
+		return cr.n, ErrChecksum
+	}
+
+	f.mu.Lock()
+	f.fingerprint = bits
+	f.m = m
+	f.k = k
+	f.count = count
+	f.mu.Unlock()
+
+	return cr.n, nil
+}
+
+// appendSpec append spec prefixed by its uint16 length to b.
+func appendSpec(b []byte, spec string) ([]byte, error) {
+	if len(spec) > maxSpecSize {
+		return nil, fmt.Errorf("%w: hash spec of %d bytes", ErrInvalidFormat, len(spec))
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(spec)))
+	return append(b, spec...), nil
+}
+
+// readSpec read a hash spec prefixed by its uint16 length.
+func readSpec(r io.Reader) (string, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", readError(err)
+	}
+	spec := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, spec); err != nil {
+		return "", readError(err)
+	}
+
+	return string(spec), nil
+}
+
+// readBits read size bytes from r, starting with a readChunkSize buffer doubled when full,
+// so truncated input with a bogus size fail before allocating more than twice the input.
+func readBits(r io.Reader, size uint64) ([]byte, error) {
+	bits := make([]byte, 0, min(size, readChunkSize))
+	for uint64(len(bits)) < size {
+		if len(bits) == cap(bits) {
+			grown := make([]byte, len(bits), min(size, 2*uint64(cap(bits))))
+			copy(grown, bits)
+			bits = grown
+		}
+		n, err := io.ReadFull(r, bits[len(bits):cap(bits)])
+		bits = bits[:len(bits)+n]
+		if err != nil {
+			return nil, readError(err)
+		}
+	}
+
+	return bits, nil
+}
+
+// marshalBinary stream w in a buffer of size bytes.
+func marshalBinary(w io.WriterTo, size int) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := w.WriteTo(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// unmarshalBinary load data in r and refuse trailing bytes.
+func unmarshalBinary(r io.ReaderFrom, data []byte) error {
+	br := bytes.NewReader(data)
+	if _, err := r.ReadFrom(br); err != nil {
+		return err
+	}
+	if br.Len() != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidFormat, br.Len())
+	}
+
+	return nil
+}
+
+// readError report truncated input as invalid format.
+func readError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	return err
+}
+
+// countReader count bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// validate check that m and k are usable with the filter hash and strategy.
+func (f *filter) validate(m, k uint64) error {
+	// the bits array should hold m bits without overflow
+	if m > maxBits || f.strategy.size(m)*8 < m {
+		return fmt.Errorf("%w: m=%d k=%d", ErrInvalidFormat, m, k)
+	}
+	size := uint64(f.hash.Size())
+
+	var ok bool
+	switch f.strategy {
+	case strategyDigest:
+		ok = m == size*8 && k == 0
+	case strategyChunk:
+		ok = m > 0 && m <= math.MaxUint32+1 && k > 0 && k*4 <= size
+	case strategyDoubleHashing:
+		// each lookup compute k positions, a huge k would hang it
+		ok = m > 0 && k > 0 && k <= maxStackPositions && size >= 16
+	case strategyBlocked:
+		ok = m > 0 && m%BlockBits == 0 && k > 0 && k <= maxStackPositions && size >= 16
+	}
+	if !ok {
+		return fmt.Errorf("%w: m=%d k=%d", ErrInvalidFormat, m, k)
+	}
+
+	return nil
+}
@@ -0,0 +1,462 @@
+package bloom_test
+
+import (
+	"bloom"
+	"bloom/customhash"
+	"bloom/hashspec"
+	"bytes"
+	"crypto"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// binaryFilter is a bloom.Filter that can be stored as binary.
+type binaryFilter interface {
+	bloom.Filter
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+func TestBloomFilterBinary(t *testing.T) {
+	tests := []struct {
+		name      string
+		newFilter func() (binaryFilter, error)
+	}{
+		{
+			name: "MD5",
+			newFilter: func() (binaryFilter, error) {
+				return bloom.New(crypto.MD5.New())
+			},
+		},
+		{
+			name: "SHA512xCustom2",
+			newFilter: func() (binaryFilter, error) {
+				return bloom.New(skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})))
+			},
+		},
+		{
+			name: "SHA512-Estimates",
+			newFilter: func() (binaryFilter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, crypto.SHA512.New())
+			},
+		},
+		{
+			name: "Murmur3_128-DoubleHashing",
+			newFilter: func() (binaryFilter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.newFilter()
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+
+			data, err := filter.MarshalBinary()
+			require.NoError(t, err)
+
+			filter2, err := tt.newFilter()
+			require.NoError(t, err)
+			require.NoError(t, filter2.UnmarshalBinary(data))
+			for i := 0; i < 100; i++ {
+				assert.True(t, filter2.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+
+			data2, err := filter2.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, data, data2, "round trip")
+
+			t.Run("Truncated", func(t *testing.T) {
+				assert.ErrorIs(t, filter2.UnmarshalBinary(data[:10]), bloom.ErrInvalidFormat)
+			})
+
+			t.Run("Magic", func(t *testing.T) {
+				corrupted := append([]byte(nil), data...)
+				corrupted[0] = 'X'
+				assert.ErrorIs(t, filter2.UnmarshalBinary(corrupted), bloom.ErrInvalidFormat)
+			})
+
+			t.Run("Version", func(t *testing.T) {
+				corrupted := append([]byte(nil), data...)
+				corrupted[4] = 42
+				assert.ErrorIs(t, filter2.UnmarshalBinary(corrupted), bloom.ErrUnsupportedVersion)
+			})
+
+			t.Run("Checksum", func(t *testing.T) {
+				corrupted := append([]byte(nil), data...)
+				corrupted[len(corrupted)-5] ^= 0xff
+				assert.ErrorIs(t, filter2.UnmarshalBinary(corrupted), bloom.ErrChecksum)
+			})
+		})
+	}
+}
+
+func TestBloomFilterBinaryHashMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  func() (binaryFilter, error)
+		to    func() (binaryFilter, error)
+		equal bool
+	}{
+		{
+			name: "same salts",
+			from: func() (binaryFilter, error) {
+				return bloom.New(skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})))
+			},
+			to: func() (binaryFilter, error) {
+				return bloom.New(skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})))
+			},
+			equal: true,
+		},
+		{
+			name: "different salts",
+			from: func() (binaryFilter, error) {
+				return bloom.New(skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})))
+			},
+			to: func() (binaryFilter, error) {
+				return bloom.New(skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("aFdMvnSD")})))
+			},
+		},
+		{
+			name: "different hash",
+			from: func() (binaryFilter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, crypto.SHA512.New())
+			},
+			to: func() (binaryFilter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, crypto.BLAKE2b_512.New())
+			},
+		},
+		{
+			name: "different strategy",
+			from: func() (binaryFilter, error) {
+				return bloom.NewWithEstimates(1000, 0.01, crypto.SHA512.New())
+			},
+			to: func() (binaryFilter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01, crypto.SHA512.New())
+			},
+		},
+		{
+			name: "different size",
+			from: func() (binaryFilter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01)
+			},
+			to: func() (binaryFilter, error) {
+				return bloom.NewDoubleHashing(10, 0.05)
+			},
+			equal: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			from, err := tt.from()
+			require.NoError(t, err)
+			from.Add([]byte("https://example.com/"))
+
+			data, err := from.MarshalBinary()
+			require.NoError(t, err)
+
+			to, err := tt.to()
+			require.NoError(t, err)
+			err = to.UnmarshalBinary(data)
+			if !tt.equal {
+				assert.ErrorIs(t, err, bloom.ErrHashMismatch)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, to.Contain([]byte("https://example.com/")))
+		})
+	}
+}
+
+func TestNewFromBinary(t *testing.T) {
+	tests := []struct {
+		name      string
+		newFilter func(h hash.Hash) (binaryFilter, error)
+	}{
+		{
+			name: "Digest",
+			newFilter: func(h hash.Hash) (binaryFilter, error) {
+				return bloom.New(h)
+			},
+		},
+		{
+			name: "DoubleHashing",
+			newFilter: func(h hash.Hash) (binaryFilter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01, h)
+			},
+		},
+		{
+			name: "Blocked",
+			newFilter: func(h hash.Hash) (binaryFilter, error) {
+				return bloom.NewBlocked(1000, 0.01, h)
+			},
+		},
+		{
+			name: "Sparse",
+			newFilter: func(h hash.Hash) (binaryFilter, error) {
+				return bloom.NewSparse(1000, 0.01, h)
+			},
+		},
+		{
+			name: "Scalable",
+			newFilter: func(h hash.Hash) (binaryFilter, error) {
+				return bloom.NewScalable(1000, 0.01, h)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := hashspec.Parse(`multi(custom(sha512, salts=2, seed="s"), salt(murmur3, "x"))`)
+			require.NoError(t, err)
+			filter, err := tt.newFilter(spec.New())
+			require.NoError(t, err)
+			filter.Add([]byte("https://example.com/"))
+
+			data, err := filter.MarshalBinary()
+			require.NoError(t, err)
+
+			// the hash is rebuilt from the embedded spec
+			loaded, err := bloom.NewFromBinary(data)
+			require.NoError(t, err)
+			assert.True(t, loaded.Contain([]byte("https://example.com/")))
+			loadedData, err := loaded.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, data, loadedData)
+
+			// and loaded in a filter with the same hash
+			same, err := tt.newFilter(spec.New())
+			require.NoError(t, err)
+			require.NoError(t, same.UnmarshalBinary(data))
+			assert.True(t, same.Contain([]byte("https://example.com/")))
+		})
+	}
+
+	t.Run("MissingSpec", func(t *testing.T) {
+		filter, err := bloom.NewDoubleHashing(1000, 0.01)
+		require.NoError(t, err)
+		data, err := filter.MarshalBinary()
+		require.NoError(t, err)
+
+		_, err = bloom.NewFromBinary(data)
+		assert.ErrorIs(t, err, bloom.ErrMissingSpec)
+	})
+
+	t.Run("InvalidSpec", func(t *testing.T) {
+		filter, err := bloom.NewDoubleHashing(1000, 0.01, skipError(hashspec.New("murmur3")))
+		require.NoError(t, err)
+		data, err := filter.MarshalBinary()
+		require.NoError(t, err)
+
+		i := bytes.Index(data, []byte("murmur3"))
+		require.Greater(t, i, 0)
+		copy(data[i:], "murmur4")
+		_, err = bloom.NewFromBinary(data)
+		assert.ErrorIs(t, err, hashspec.ErrInvalidSpec)
+	})
+}
+
+func TestBloomFilterStream(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(10000, 0.01)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+
+	var buf bytes.Buffer
+	n, err := filter.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n, "written")
+
+	data, err := filter.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, data, buf.Bytes(), "same as MarshalBinary")
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		filter2, err := bloom.NewDoubleHashing(10000, 0.01)
+		require.NoError(t, err)
+
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := filter.WriteTo(pw)
+			pw.CloseWithError(err)
+		}()
+
+		n, err := filter2.ReadFrom(pr)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), n, "read")
+		for i := 0; i < 1000; i++ {
+			assert.True(t, filter2.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		filter2, err := bloom.NewDoubleHashing(10000, 0.01)
+		require.NoError(t, err)
+
+		_, err = filter2.ReadFrom(io.LimitReader(bytes.NewReader(data), int64(len(data)-1)))
+		assert.ErrorIs(t, err, bloom.ErrInvalidFormat)
+		assert.False(t, filter2.Contain([]byte("https://example.com/0")), "partially loaded")
+	})
+
+	t.Run("TrailingData", func(t *testing.T) {
+		filter2, err := bloom.NewDoubleHashing(10000, 0.01)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, filter2.UnmarshalBinary(append(data, 0)), bloom.ErrInvalidFormat)
+	})
+
+	t.Run("WriteError", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		pr.CloseWithError(io.ErrClosedPipe)
+
+		_, err := filter.WriteTo(pw)
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	})
+}
+
+func BenchmarkBloomFilterStream(b *testing.B) {
+	for _, n := range []uint64{1000000, 10000000} {
+		n := n
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			filter, err := bloom.NewDoubleHashing(n, 0.01)
+			require.NoError(b, err)
+			for i := 0; i < 1000; i++ {
+				filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			data, err := filter.MarshalBinary()
+			require.NoError(b, err)
+
+			b.Run("WriteTo", func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := filter.WriteTo(io.Discard); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run("ReadFrom", func(b *testing.B) {
+				filter2, err := bloom.NewDoubleHashing(n, 0.01)
+				require.NoError(b, err)
+				r := bytes.NewReader(data)
+
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					r.Reset(data)
+					if _, err := filter2.ReadFrom(r); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run("String", func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_ = filter.String()
+				}
+			})
+		})
+	}
+}
+
+func TestBloomFilterBinaryInvalidSize(t *testing.T) {
+	for name, newFilter := range map[string]func() (binaryFilter, error){
+		"double hashing": func() (binaryFilter, error) { return bloom.NewDoubleHashing(1000, 0.01) },
+		"blocked":        func() (binaryFilter, error) { return bloom.NewBlocked(1000, 0.01) },
+		"chunk":          func() (binaryFilter, error) { return bloom.NewWithEstimates(1000, 0.01, crypto.SHA512.New()) },
+	} {
+		newFilter := newFilter
+		t.Run(name, func(t *testing.T) {
+			filter, err := newFilter()
+			require.NoError(t, err)
+			filter.Add([]byte("https://example.com/"))
+			data, err := filter.MarshalBinary()
+			require.NoError(t, err)
+
+			for _, m := range []uint64{0, math.MaxUint64, math.MaxUint64 - 511, 1 << 62, 1<<40 + 512} {
+				corrupted := append([]byte(nil), data...)
+				binary.BigEndian.PutUint64(corrupted[14:], m)
+				assert.ErrorIs(t, filter.UnmarshalBinary(corrupted), bloom.ErrInvalidFormat, m)
+			}
+			assert.True(t, filter.Contain([]byte("https://example.com/")))
+		})
+	}
+}
+
+func TestBloomFilterStreamBogusSize(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	data, err := filter.MarshalBinary()
+	require.NoError(t, err)
+
+	// the largest valid size, the input end long before
+	corrupted := append([]byte(nil), data...)
+	binary.BigEndian.PutUint64(corrupted[14:], 1<<40)
+
+	allocs := testing.AllocsPerRun(1, func() {
+		_, err = filter.ReadFrom(bytes.NewReader(corrupted))
+	})
+	assert.ErrorIs(t, err, bloom.ErrInvalidFormat)
+	assert.Less(t, allocs, 20.0)
+}
+
+func TestBloomFilterBinaryBogusPositions(t *testing.T) {
+	tests := []struct {
+		name      string
+		newFilter func() (binaryFilter, error)
+	}{
+		{
+			name: "DoubleHashing",
+			newFilter: func() (binaryFilter, error) {
+				return bloom.NewDoubleHashing(1000, 0.01)
+			},
+		},
+		{
+			name: "Blocked",
+			newFilter: func() (binaryFilter, error) {
+				return bloom.NewBlocked(1000, 0.01)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.newFilter()
+			require.NoError(t, err)
+			data, err := filter.MarshalBinary()
+			require.NoError(t, err)
+
+			// a valid checksum over a k computing positions for hours
+			corrupted := append([]byte(nil), data...)
+			binary.BigEndian.PutUint64(corrupted[22:], 1<<34)
+			binary.BigEndian.PutUint32(corrupted[len(corrupted)-4:], crc32.Checksum(corrupted[:len(corrupted)-4], crc32.MakeTable(crc32.Castagnoli)))
+
+			assert.ErrorIs(t, filter.UnmarshalBinary(corrupted), bloom.ErrInvalidFormat)
+			_, err = filter.(io.ReaderFrom).ReadFrom(bytes.NewReader(corrupted))
+			assert.ErrorIs(t, err, bloom.ErrInvalidFormat)
+		})
+	}
+
+	// and filters needing more positions are never created
+	_, err := bloom.NewDoubleHashing(1000, 1e-12)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+}
@@ -0,0 +1,12 @@
+package bloom
+
+import "time"
+
+// SetClock replace the clock of an age partitioned filter, the current generation start now.
+func SetClock(f *agingFilter, now func() time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = now
+	f.next = now().Add(f.interval)
+}
@@ -0,0 +1,430 @@
+package fuse
+
+import (
+	"bloom"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// check interface implementation
+var (
+	_ bloom.ReadOnlyFilter       = &FuseFilter{}
+	_ encoding.BinaryMarshaler   = &FuseFilter{}
+	_ encoding.BinaryUnmarshaler = &FuseFilter{}
+)
+
+var (
+	ErrHashTooShort = bloom.ErrHashTooShort
+	ErrBuild        = errors.New("fuse filter construction failed")
+)
+
+const (
+	// arity is the number of fingerprints xor'ed by object.
+	arity = 3
+	// maxSegmentLength bound segments so that they stay cache friendly on huge sets.
+	maxSegmentLength = 1 << 18
+	// maxIterations is the number of seeds tried before giving up, a try fail with probability < 1% on real sets.
+	maxIterations = 100
+	// formatVersion is the current version of binary representation.
+	formatVersion = 1
+	// headerSize is the size of magic, version, hashID, seed, segment length, segment count and count.
+	headerSize = 4 + 1 + 8 + 8 + 4 + 4 + 8
+	// checksumSize is the size of the trailing crc32.
+	checksumSize = 4
+)
+
+var (
+	magic    = [4]byte{'B', 'L', 'M', 'X'}
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// FuseFilter is a static binary fuse filter (Graf & Lemire) with 8 bits fingerprints: an object is present
+// when the xor of its 3 fingerprints, chosen in 3 consecutive segments, equals its own fingerprint.
+// The set of objects is given once at construction and can not change, in return it use 9 to 9.5 bits by object
+// for a 0.39% false positive rate where a bloom filter need 11.5 bits, about 20% less.
+type FuseFilter struct {
+	mu     sync.Mutex // guard hash only, fingerprints are read-only
+	hash   hash.Hash
+	hashID uint64
+
+	seed               uint64
+	segmentLength      uint32
+	segmentLengthMask  uint32
+	segmentCount       uint32
+	segmentCountLength uint32
+	fingerprints       []uint8
+	count              uint64
+}
+
+// New build a filter containing keys. Without hash a 128 bits murmur3 is used, hash should produce at least 8 bytes.
+// Duplicated keys are only counted once.
+func New(keys [][]byte, hashList ...hash.Hash) (*FuseFilter, error) {
+	f, err := newFilter(hashList...)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make([]uint64, 0, len(keys))
+	for _, key := range keys {
+		set = append(set, f.key(f.hashBytes(key)))
+	}
+
+	return f, f.build(set)
+}
+
+// NewFromFingerprints build a filter containing fingerprints pushed by each, fingerprints should
+// be produced by the same hash configuration as hashList. each has the signature of a Go 1.23 iter.Seq
+// so fingerprints can be streamed from another filter or storage without being kept in memory.
+func NewFromFingerprints(each func(yield func(fp []byte) bool), hashList ...hash.Hash) (*FuseFilter, error) {
+	f, err := newFilter(hashList...)
+	if err != nil {
+		return nil, err
+	}
+
+	var set []uint64
+	each(func(fp []byte) bool {
+		if len(fp) < 8 { // stop at the first short fingerprint
+			err = fmt.Errorf("%w: fingerprint of %d bytes", ErrHashTooShort, len(fp))
+			return false
+		}
+		set = append(set, f.key(fp))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f, f.build(set)
+}
+
+func newFilter(hashList ...hash.Hash) (*FuseFilter, error) {
+	hash, err := bloom.GroupHash(hashList...)
+	if err != nil {
+		return nil, err
+	}
+	if hash.Size() < 8 {
+		return nil, fmt.Errorf("%w: need 8 bytes, hash only produce %d", ErrHashTooShort, hash.Size())
+	}
+
+	f := &FuseFilter{
+		hash:   hash,
+		hashID: bloom.HashID(hash),
+	}
+	f.init(0)
+
+	return f, nil
+}
+
+// init size segments and fingerprints for size objects.
+func (f *FuseFilter) init(size uint32) {
+	segmentLength := uint32(4)
+	sizeFactor := 0.0
+	if size > 1 {
+		segmentLength = 1 << int(math.Floor(math.Log(float64(size))/math.Log(3.33)+2.25))
+		if segmentLength > maxSegmentLength {
+			segmentLength = maxSegmentLength
+		}
+		sizeFactor = math.Max(1.125, 0.875+0.25*math.Log(1000000)/math.Log(float64(size)))
+	}
+	capacity := uint32(math.Round(float64(size) * sizeFactor))
+
+	segmentCount := (capacity + segmentLength - 1) / segmentLength
+	if segmentCount <= arity-1 {
+		segmentCount = 1
+	} else {
+		segmentCount -= arity - 1
+	}
+
+	f.segmentLength = segmentLength
+	f.segmentLengthMask = segmentLength - 1
+	f.segmentCount = segmentCount
+	f.segmentCountLength = segmentCount * segmentLength
+	f.fingerprints = make([]uint8, (segmentCount+arity-1)*segmentLength)
+}
+
+// build peel the hypergraph of keys and assign fingerprints, trying new seeds until it succeed.
+func (f *FuseFilter) build(keys []uint64) error {
+	keys = unique(keys)
+	size := uint32(len(keys))
+	f.init(size)
+	if size == 0 {
+		return nil
+	}
+
+	capacity := uint32(len(f.fingerprints))
+	// count is the number of keys using a slot (<<2) xor'ed with the index 0, 1 or 2 of the slot for these keys
+	count := make([]uint8, capacity)
+	xorHash := make([]uint64, capacity)
+	alone := make([]uint32, capacity)
+	reverseH := make([]uint8, size)
+	// hashes sorted by segment for cache locality, then peeled hashes
+	reverseOrder := make([]uint64, size+1)
+	reverseOrder[size] = 1 // sentinel
+
+	blockBits := 1
+	for (uint32(1) << blockBits) < f.segmentCount {
+		blockBits++
+	}
+	startPos := make([]uint32, 1<<blockBits)
+
+	rng := uint64(0x726b2b9d438b9d4d)
+	var h012 [5]uint32
+	for iteration := 0; ; iteration++ {
+		if iteration >= maxIterations {
+			return fmt.Errorf("%w: %d seeds tried", ErrBuild, iteration)
+		}
+		f.seed = splitmix64(&rng)
+
+		for i := range startPos {
+			startPos[i] = uint32((uint64(i) * uint64(size)) >> blockBits)
+		}
+		for _, key := range keys {
+			h := mixsplit(key, f.seed)
+			segment := h >> (64 - blockBits)
+			for reverseOrder[startPos[segment]] != 0 {
+				segment = (segment + 1) & (1<<blockBits - 1)
+			}
+			reverseOrder[startPos[segment]] = h
+			startPos[segment]++
+		}
+
+		failed := false
+		for _, h := range reverseOrder[:size] {
+			h0, h1, h2 := f.positions(h)
+			count[h0] += 4
+			xorHash[h0] ^= h
+			count[h1] += 4
+			count[h1] ^= 1
+			xorHash[h1] ^= h
+			count[h2] += 4
+			count[h2] ^= 2
+			xorHash[h2] ^= h
+
+			// counter overflow
+			failed = failed || count[h0] < 4 || count[h1] < 4 || count[h2] < 4
+		}
+
+		if !failed {
+			// peel slots used by a single hash
+			queue := uint32(0)
+			for i := uint32(0); i < capacity; i++ {
+				alone[queue] = i
+				if count[i]>>2 == 1 {
+					queue++
+				}
+			}
+
+			stack := uint32(0)
+			for queue > 0 {
+				queue--
+				index := alone[queue]
+				if count[index]>>2 != 1 {
+					continue
+				}
+
+				h := xorHash[index]
+				found := count[index] & 3
+				reverseH[stack] = found
+				reverseOrder[stack] = h
+				stack++
+
+				h0, h1, h2 := f.positions(h)
+				h012[1], h012[2], h012[3], h012[4] = h1, h2, h0, h1
+				for j := uint8(1); j < arity; j++ {
+					other := h012[found+j]
+					alone[queue] = other
+					if count[other]>>2 == 2 {
+						queue++
+					}
+					count[other] -= 4
+					count[other] ^= (found + j) % arity
+					xorHash[other] ^= h
+				}
+			}
+
+			if stack == size {
+				break
+			}
+		}
+
+		// retry with another seed
+		for i := range reverseOrder[:size] {
+			reverseOrder[i] = 0
+		}
+		for i := range count {
+			count[i] = 0
+			xorHash[i] = 0
+		}
+	}
+
+	// assign fingerprints in reverse peeling order, the slot of each hash is the last one it changes
+	for i := int(size) - 1; i >= 0; i-- {
+		h := reverseOrder[i]
+		h0, h1, h2 := f.positions(h)
+		found := reverseH[i]
+		h012[0], h012[1], h012[2], h012[3], h012[4] = h0, h1, h2, h0, h1
+		f.fingerprints[h012[found]] = fingerprint(h) ^ f.fingerprints[h012[found+1]] ^ f.fingerprints[h012[found+2]]
+	}
+	f.count = uint64(size)
+
+	return nil
+}
+
+func (f *FuseFilter) hashBytes(b []byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hash.Write(b)
+	fp := f.hash.Sum(nil)
+	f.hash.Reset()
+
+	return fp
+}
+
+// key reduce a hash result to the 64 bits key of the filter.
+func (f *FuseFilter) key(fp []byte) uint64 {
+	return binary.BigEndian.Uint64(fp)
+}
+
+// positions return the 3 fingerprint indexes of a hash, one in each of 3 consecutive segments.
+func (f *FuseFilter) positions(h uint64) (uint32, uint32, uint32) {
+	hi, _ := bits.Mul64(h, uint64(f.segmentCountLength))
+	h0 := uint32(hi)
+	h1 := h0 + f.segmentLength
+	h2 := h1 + f.segmentLength
+	h1 ^= uint32(h>>18) & f.segmentLengthMask
+	h2 ^= uint32(h) & f.segmentLengthMask
+	return h0, h1, h2
+}
+
+func (f *FuseFilter) Contain(b []byte) bool {
+	return f.ContainFingerprint(f.hashBytes(b))
+}
+
+func (f *FuseFilter) ContainFingerprint(fp []byte) bool {
+	h := mixsplit(f.key(fp), f.seed)
+	h0, h1, h2 := f.positions(h)
+	return fingerprint(h)^f.fingerprints[h0]^f.fingerprints[h1]^f.fingerprints[h2] == 0
+}
+
+// Count return the number of distinct objects in the filter.
+func (f *FuseFilter) Count() uint64 {
+	return f.count
+}
+
+// ByteSize return the memory used by the filter fingerprints.
+func (f *FuseFilter) ByteSize() uint64 {
+	return uint64(len(f.fingerprints))
+}
+
+// MarshalBinary encode the filter with its configuration.
+//
+// Layout (big endian):
+//
+//	magic "BLMX" | version uint8 | hashID uint64 | seed uint64 | segment length uint32 | segment count uint32 | count uint64 | fingerprints | crc32c
+func (f *FuseFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerSize, headerSize+len(f.fingerprints)+checksumSize)
+	copy(data, magic[:])
+	data[4] = formatVersion
+	binary.BigEndian.PutUint64(data[5:], f.hashID)
+	binary.BigEndian.PutUint64(data[13:], f.seed)
+	binary.BigEndian.PutUint32(data[21:], f.segmentLength)
+	binary.BigEndian.PutUint32(data[25:], f.segmentCount)
+	binary.BigEndian.PutUint64(data[29:], f.count)
+	data = append(data, f.fingerprints...)
+
+	return binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crcTable)), nil
+}
+
+// UnmarshalBinary load a filter encoded by MarshalBinary, replacing its content.
+// The filter should have been created with the same hash configuration, New(nil, hashList...) create an empty one.
+// It should not be called while the filter is used.
+func (f *FuseFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize+checksumSize || !bytes.Equal(data[:4], magic[:]) {
+		return bloom.ErrInvalidFormat
+	}
+	if data[4] != formatVersion {
+		return fmt.Errorf("%w: %d", bloom.ErrUnsupportedVersion, data[4])
+	}
+	if binary.BigEndian.Uint64(data[5:]) != f.hashID {
+		return bloom.ErrHashMismatch
+	}
+
+	seed := binary.BigEndian.Uint64(data[13:])
+	segmentLength := binary.BigEndian.Uint32(data[21:])
+	segmentCount := binary.BigEndian.Uint32(data[25:])
+	count := binary.BigEndian.Uint64(data[29:])
+
+	if segmentLength == 0 || segmentLength&(segmentLength-1) != 0 || segmentLength > maxSegmentLength ||
+		segmentCount == 0 || uint64(segmentCount)*uint64(segmentLength) > math.MaxUint32/2 {
+		return fmt.Errorf("%w: segment length=%d count=%d", bloom.ErrInvalidFormat, segmentLength, segmentCount)
+	}
+	size := int(segmentCount+arity-1) * int(segmentLength)
+	if len(data) != headerSize+size+checksumSize {
+		return fmt.Errorf("%w: %d bytes for %d fingerprints", bloom.ErrInvalidFormat, len(data), size)
+	}
+
+	body := data[:headerSize+size]
+	if binary.BigEndian.Uint32(data[headerSize+size:]) != crc32.Checksum(body, crcTable) {
+		return bloom.ErrChecksum
+	}
+
+	f.seed = seed
+	f.segmentLength = segmentLength
+	f.segmentLengthMask = segmentLength - 1
+	f.segmentCount = segmentCount
+	f.segmentCountLength = segmentCount * segmentLength
+	f.fingerprints = append([]uint8(nil), body[headerSize:]...)
+	f.count = count
+
+	return nil
+}
+
+// unique sort keys and remove duplicates in place, a duplicated key can never be peeled.
+func unique(keys []uint64) []uint64 {
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	n := 0
+	for i, key := range keys {
+		if i == 0 || key != keys[n-1] {
+			keys[n] = key
+			n++
+		}
+	}
+	return keys[:n]
+}
+
+// fingerprint return the 8 bits fingerprint of a hash.
+func fingerprint(h uint64) uint8 {
+	return uint8(h ^ (h >> 32))
+}
+
+// mixsplit mix key with the filter seed.
+func mixsplit(key, seed uint64) uint64 {
+	return murmur64(key + seed)
+}
+
+// murmur64 is the murmur3 64 bits finalizer.
+func murmur64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// splitmix64 return the next value of the splitmix64 generator in state.
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	return bloom.Mix64(*state)
+}
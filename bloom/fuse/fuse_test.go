@@ -0,0 +1,245 @@
+package fuse_test
+
+import (
+	"crypto"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/murmur3"
+
+	"bloom"
+	"bloom/fuse"
+
+	_ "crypto/md5"
+	_ "crypto/sha256"
+)
+
+func urls(from, to int) [][]byte {
+	keys := make([][]byte, 0, to-from)
+	for i := from; i < to; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	return keys
+}
+
+func TestFuseFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		hashList []hash.Hash
+		wantErr  error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "one",
+			n:    1,
+		},
+		{
+			name: "Murmur3_128/small",
+			n:    100,
+		},
+		{
+			name: "Murmur3_128",
+			n:    100000,
+		},
+		{
+			name: "MD5",
+			n:    100000,
+			hashList: []hash.Hash{
+				crypto.MD5.New(),
+			},
+		},
+		{
+			name: "SHA256+MD5",
+			n:    10000,
+			hashList: []hash.Hash{
+				crypto.SHA256.New(),
+				crypto.MD5.New(),
+			},
+		},
+		{
+			name: "FNV32 too short",
+			n:    100,
+			hashList: []hash.Hash{
+				fnv.New32a(),
+			},
+			wantErr: fuse.ErrHashTooShort,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := fuse.New(urls(0, tt.n), tt.hashList...)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint64(tt.n), filter.Count())
+
+			for _, key := range urls(0, tt.n) {
+				require.True(t, filter.Contain(key), "false negative")
+			}
+
+			missing := 100000
+			falsePositive := 0
+			for _, key := range urls(tt.n, tt.n+missing) {
+				if filter.Contain(key) {
+					falsePositive++
+				}
+			}
+			assert.Less(t, float64(falsePositive)/float64(missing), 0.006, "false positive rate")
+
+			if tt.n >= 100000 {
+				bitsPerKey := float64(filter.ByteSize()*8) / float64(tt.n)
+				assert.Less(t, bitsPerKey, 9.6, "bits by object")
+			}
+		})
+	}
+}
+
+func TestFuseFilterDuplicates(t *testing.T) {
+	keys := urls(0, 10000)
+	keys = append(keys, urls(0, 500)...)
+
+	filter, err := fuse.New(keys)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10000), filter.Count())
+	for _, key := range keys {
+		require.True(t, filter.Contain(key), "false negative")
+	}
+}
+
+func TestFuseFilterFromFingerprints(t *testing.T) {
+	// fingerprints of a closed day, as produced by the live filter hash
+	fingerprints := make([][]byte, 0, 10000)
+	h := murmur3.New128()
+	for _, key := range urls(0, 10000) {
+		h.Write(key)
+		fingerprints = append(fingerprints, h.Sum(nil))
+		h.Reset()
+	}
+
+	filter, err := fuse.NewFromFingerprints(func(yield func([]byte) bool) {
+		for _, fp := range fingerprints {
+			if !yield(fp) {
+				return
+			}
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10000), filter.Count())
+	for i, key := range urls(0, 10000) {
+		require.True(t, filter.ContainFingerprint(fingerprints[i]), "false negative")
+		require.True(t, filter.Contain(key), "false negative")
+	}
+
+	_, err = fuse.NewFromFingerprints(func(yield func([]byte) bool) {
+		yield([]byte{1, 2, 3})
+	})
+	assert.ErrorIs(t, err, fuse.ErrHashTooShort)
+	assert.ErrorIs(t, err, bloom.ErrHashTooShort, "shared with the bloom package")
+}
+
+func TestFuseFilterBinary(t *testing.T) {
+	filter, err := fuse.New(urls(0, 10000))
+	require.NoError(t, err)
+
+	data, err := filter.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, 37+int(filter.ByteSize())+4, len(data))
+
+	loaded, err := fuse.New(nil)
+	require.NoError(t, err)
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	assert.Equal(t, filter.Count(), loaded.Count())
+	for _, key := range urls(0, 10000) {
+		require.True(t, loaded.Contain(key), "false negative")
+	}
+	for _, key := range urls(10000, 20000) {
+		require.Equal(t, filter.Contain(key), loaded.Contain(key))
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		hashList []hash.Hash
+		wantErr  error
+	}{
+		{
+			name:    "truncated",
+			data:    data[:len(data)-1],
+			wantErr: bloom.ErrInvalidFormat,
+		},
+		{
+			name:    "magic",
+			data:    append([]byte("XXXX"), data[4:]...),
+			wantErr: bloom.ErrInvalidFormat,
+		},
+		{
+			name:    "version",
+			data:    append(append(append([]byte(nil), data[:4]...), 9), data[5:]...),
+			wantErr: bloom.ErrUnsupportedVersion,
+		},
+		{
+			name: "hash",
+			data: data,
+			hashList: []hash.Hash{
+				crypto.MD5.New(),
+			},
+			wantErr: bloom.ErrHashMismatch,
+		},
+		{
+			name: "checksum",
+			data: func() []byte {
+				corrupted := append([]byte(nil), data...)
+				corrupted[100] ^= 1
+				return corrupted
+			}(),
+			wantErr: bloom.ErrChecksum,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := fuse.New(nil, tt.hashList...)
+			require.NoError(t, err)
+			assert.ErrorIs(t, loaded.UnmarshalBinary(tt.data), tt.wantErr)
+		})
+	}
+}
+
+func BenchmarkFuseFilter(b *testing.B) {
+	b.Run("Build", func(b *testing.B) {
+		keys := urls(0, 100000)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			_, err := fuse.New(keys)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("Contain", func(b *testing.B) {
+		nbObjectInFilter := 100000
+		filter, err := fuse.New(urls(0, nbObjectInFilter))
+		require.NoError(b, err)
+		missing_objects := urls(nbObjectInFilter, nbObjectInFilter+b.N)
+		b.ResetTimer()
+
+		false_positive := float64(0)
+		for _, o := range missing_objects {
+			if filter.Contain(o) {
+				false_positive++
+			}
+		}
+		b.ReportMetric(100*false_positive/float64(b.N), "%fp")
+		b.ReportMetric(float64(filter.ByteSize())/float64(nbObjectInFilter), "B/object")
+	})
+}
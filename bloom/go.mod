@@ -1,18 +1,19 @@
 module bloom
 
-go 1.19
+go 1.22
 
 require (
 	github.com/brianvoe/gofakeit/v6 v6.19.0
+	github.com/klauspost/compress v1.18.0
 	github.com/satori/go.uuid v1.2.0
 	github.com/stretchr/testify v1.8.0
+	github.com/twmb/murmur3 v1.1.8
 	golang.org/x/crypto v0.0.0-20221005025214-4161e89ecf1b
-	golang.org/x/sync v0.0.0-20220929204114-8fcdb60fdcc0
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
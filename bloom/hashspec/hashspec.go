@@ -0,0 +1,379 @@
+package hashspec
+
+import (
+	"bloom/customhash"
+	"bloom/multiplehash"
+	"bloom/salthash"
+	"crypto"
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/twmb/murmur3"
+	_ "golang.org/x/crypto/blake2b"
+	_ "golang.org/x/crypto/blake2s"
+	_ "golang.org/x/crypto/ripemd160"
+	_ "golang.org/x/crypto/sha3"
+)
+
+// check interface implementation
+var (
+	_ hash.Hash                = &Hash{}
+	_ encoding.TextMarshaler   = Spec{}
+	_ encoding.TextUnmarshaler = &Spec{}
+)
+
+var ErrInvalidSpec = errors.New("invalid hash spec")
+
+const (
+	// murmur3Name is the 128 bits murmur3, the only non cryptographic hash.
+	murmur3Name = "murmur3"
+	// maxSalts limit the number of salts of custom(..., salts=N).
+	maxSalts = 1024
+	// saltSize is the size of salts derived from a seed.
+	saltSize = 16
+)
+
+// algorithms are the cryptographic hashes by spec name.
+var algorithms = map[string]crypto.Hash{
+	"md5":         crypto.MD5,
+	"sha1":        crypto.SHA1,
+	"sha224":      crypto.SHA224,
+	"sha256":      crypto.SHA256,
+	"sha384":      crypto.SHA384,
+	"sha512":      crypto.SHA512,
+	"sha512_224":  crypto.SHA512_224,
+	"sha512_256":  crypto.SHA512_256,
+	"sha3_224":    crypto.SHA3_224,
+	"sha3_256":    crypto.SHA3_256,
+	"sha3_384":    crypto.SHA3_384,
+	"sha3_512":    crypto.SHA3_512,
+	"blake2s_256": crypto.BLAKE2s_256,
+	"blake2b_256": crypto.BLAKE2b_256,
+	"blake2b_384": crypto.BLAKE2b_384,
+	"blake2b_512": crypto.BLAKE2b_512,
+	"ripemd160":   crypto.RIPEMD160,
+}
+
+// Spec describe a tree of hashes in a short text form, to build filters from configuration:
+//
+//	sha256                             a single hash, murmur3 is the 128 bits murmur3
+//	salt(sha1, "x")                    hash of "x" followed by the object, see salthash
+//	custom(sha256, "a", "b")           a hash by salt with results concatenated, see customhash
+//	custom(sha256, salts=4, seed="s")  4 salts of 16 bytes derived from seed, the first 16 bytes of sha256(seed | i)
+//	multi(md5, salt(sha1, "x"))        results of all hashes concatenated, see multiplehash
+//
+// Specs are text marshalers so they can be used as is in JSON or YAML configurations.
+// The zero Spec is invalid.
+type Spec struct {
+	root node
+}
+
+// Parse parse a spec like "multi(md5, salt(sha1, \"x\"))".
+func Parse(s string) (Spec, error) {
+	c, err := parse(s)
+	if err != nil {
+		return Spec{}, err
+	}
+	root, err := compile(c)
+	if err != nil {
+		return Spec{}, err
+	}
+
+	return Spec{root: root}, nil
+}
+
+// New parse spec and build its hash.
+func New(spec string) (*Hash, error) {
+	s, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	return s.New(), nil
+}
+
+// New build a new hash tree, each call return independent hashes.
+func (s Spec) New() *Hash {
+	return &Hash{
+		Hash: s.root.build(),
+		spec: s.String(),
+		root: s.root,
+	}
+}
+
+// String return the canonical form of the spec, parsed to the same spec.
+func (s Spec) String() string {
+	if s.root == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	s.root.format(&b)
+	return b.String()
+}
+
+func (s Spec) MarshalText() ([]byte, error) {
+	if s.root == nil {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidSpec)
+	}
+	return []byte(s.String()), nil
+}
+
+func (s *Spec) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// Hash is a hash built from a Spec, it remember its spec so filters can record how to rebuild it.
+type Hash struct {
+	hash.Hash
+	spec string
+	root node
+}
+
+// Spec return the canonical spec of the hash.
+func (h *Hash) Spec() string {
+	return h.spec
+}
+
+// Clone build a new hash from the same spec, independent of h and in its initial state.
+func (h *Hash) Clone() *Hash {
+	return &Hash{
+		Hash: h.root.build(),
+		spec: h.spec,
+		root: h.root,
+	}
+}
+
+// node is a compiled hash expression.
+type node interface {
+	build() hash.Hash
+	format(b *strings.Builder)
+}
+
+// algorithm is a single hash, hash is 0 for murmur3.
+type algorithm struct {
+	name string
+	hash crypto.Hash
+}
+
+func (a algorithm) build() hash.Hash {
+	if a.name == murmur3Name {
+		return murmur3.New128()
+	}
+	return a.hash.New()
+}
+
+func (a algorithm) format(b *strings.Builder) {
+	b.WriteString(a.name)
+}
+
+// salted is salt(hash, "salt").
+type salted struct {
+	hash node
+	salt []byte
+}
+
+func (s salted) build() hash.Hash {
+	return salthash.New(s.hash.build(), s.salt)
+}
+
+func (s salted) format(b *strings.Builder) {
+	b.WriteString("salt(")
+	s.hash.format(b)
+	b.WriteString(", ")
+	b.WriteString(strconv.Quote(string(s.salt)))
+	b.WriteString(")")
+}
+
+// custom is custom(hash, salts...) or custom(hash, salts=N, seed="seed").
+type custom struct {
+	hash  algorithm
+	salts [][]byte
+	// seeded is set when salts are derived from seed.
+	seeded bool
+	seed   string
+}
+
+func (c custom) build() hash.Hash {
+	// salts are never empty once compiled
+	h, _ := customhash.New(c.hash.hash, c.salts)
+	return h
+}
+
+func (c custom) format(b *strings.Builder) {
+	b.WriteString("custom(")
+	c.hash.format(b)
+	if c.seeded {
+		fmt.Fprintf(b, ", salts=%d, seed=%s", len(c.salts), strconv.Quote(c.seed))
+	} else {
+		for _, s := range c.salts {
+			b.WriteString(", ")
+			b.WriteString(strconv.Quote(string(s)))
+		}
+	}
+	b.WriteString(")")
+}
+
+// deriveSalts return n salts of saltSize bytes derived from seed.
+func deriveSalts(n int, seed string) [][]byte {
+	salts := make([][]byte, n)
+	for i := range salts {
+		h := sha256.New()
+		h.Write([]byte(seed))
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+		salts[i] = h.Sum(nil)[:saltSize]
+	}
+	return salts
+}
+
+// multi is multi(hashes...).
+type multi struct {
+	hashes []node
+}
+
+func (m multi) build() hash.Hash {
+	hashList := make([]hash.Hash, len(m.hashes))
+	for i, n := range m.hashes {
+		hashList[i] = n.build()
+	}
+	// hashes are never empty once compiled
+	h, _ := multiplehash.New(hashList...)
+	return h
+}
+
+func (m multi) format(b *strings.Builder) {
+	b.WriteString("multi(")
+	for i, n := range m.hashes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		n.format(b)
+	}
+	b.WriteString(")")
+}
+
+func errorAt(pos int, format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrInvalidSpec, fmt.Sprintf(format, args...), pos)
+}
+
+// compile check the arguments of c and return its node.
+func compile(c *call) (node, error) {
+	switch c.name {
+	case "salt":
+		return compileSalt(c)
+	case "custom":
+		return compileCustom(c)
+	case "multi":
+		return compileMulti(c)
+	}
+
+	if len(c.args) > 0 {
+		return nil, errorAt(c.pos, "%s take no argument", c.name)
+	}
+	return compileAlgorithm(c)
+}
+
+func compileAlgorithm(c *call) (algorithm, error) {
+	if c.name == murmur3Name {
+		return algorithm{name: murmur3Name}, nil
+	}
+	h, ok := algorithms[c.name]
+	if !ok {
+		return algorithm{}, errorAt(c.pos, "unknown hash %s", c.name)
+	}
+	return algorithm{name: c.name, hash: h}, nil
+}
+
+// compileSalt compile salt(hash, "salt").
+func compileSalt(c *call) (node, error) {
+	if len(c.args) != 2 || c.args[0].call == nil || !c.args[1].quoted || c.args[0].key != "" || c.args[1].key != "" {
+		return nil, errorAt(c.pos, `expected salt(hash, "salt")`)
+	}
+	h, err := compile(c.args[0].call)
+	if err != nil {
+		return nil, err
+	}
+
+	return salted{hash: h, salt: []byte(c.args[1].literal)}, nil
+}
+
+// compileCustom compile custom(hash, "salt", ...) or custom(hash, salts=N, seed="seed").
+func compileCustom(c *call) (node, error) {
+	if len(c.args) == 0 || c.args[0].call == nil || c.args[0].key != "" || len(c.args[0].call.args) > 0 {
+		return nil, errorAt(c.pos, "expected custom(hash, ...) with a single hash")
+	}
+	h, err := compileAlgorithm(c.args[0].call)
+	if err != nil {
+		return nil, err
+	}
+	if h.name == murmur3Name {
+		return nil, errorAt(c.args[0].pos, "custom need a cryptographic hash")
+	}
+
+	n := custom{hash: h}
+	count := 0
+	for _, a := range c.args[1:] {
+		switch {
+		case a.key == "" && a.quoted:
+			n.salts = append(n.salts, []byte(a.literal))
+		case a.key == "salts" && a.call == nil && !a.quoted:
+			count, err = strconv.Atoi(a.literal)
+			if err != nil || count < 1 || count > maxSalts {
+				return nil, errorAt(a.pos, "salts should be between 1 and %d", maxSalts)
+			}
+		case a.key == "seed" && a.call == nil:
+			n.seed = a.literal
+			n.seeded = true
+		default:
+			return nil, errorAt(a.pos, "unexpected custom argument")
+		}
+	}
+
+	switch {
+	case count > 0 && len(n.salts) > 0:
+		return nil, errorAt(c.pos, "custom take either salts or salts=N")
+	case count > 0:
+		n.salts = deriveSalts(count, n.seed)
+		n.seeded = true
+	case n.seeded:
+		return nil, errorAt(c.pos, "seed need salts=N")
+	case len(n.salts) == 0:
+		return nil, errorAt(c.pos, "custom need at least a salt")
+	}
+
+	return n, nil
+}
+
+// compileMulti compile multi(hash, ...).
+func compileMulti(c *call) (node, error) {
+	if len(c.args) == 0 {
+		return nil, errorAt(c.pos, "multi need at least a hash")
+	}
+
+	m := multi{}
+	for _, a := range c.args {
+		if a.call == nil || a.key != "" {
+			return nil, errorAt(a.pos, "multi only take hashes")
+		}
+		h, err := compile(a.call)
+		if err != nil {
+			return nil, err
+		}
+		m.hashes = append(m.hashes, h)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,166 @@
+package hashspec_test
+
+import (
+	"bloom/customhash"
+	"bloom/hashspec"
+	"bloom/multiplehash"
+	"bloom/salthash"
+	"crypto"
+	"encoding/json"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/murmur3"
+)
+
+func skipError[T any](v T, _ error) T {
+	return v
+}
+
+func TestSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		canonical string
+		want      hash.Hash
+	}{
+		{
+			name:      "algorithm",
+			spec:      "sha256",
+			canonical: "sha256",
+			want:      crypto.SHA256.New(),
+		},
+		{
+			name:      "murmur3",
+			spec:      " Murmur3 ",
+			canonical: "murmur3",
+			want:      murmur3.New128(),
+		},
+		{
+			name:      "salt",
+			spec:      `salt(sha1,"x")`,
+			canonical: `salt(sha1, "x")`,
+			want:      salthash.New(crypto.SHA1.New(), []byte("x")),
+		},
+		{
+			name:      "custom",
+			spec:      `custom(sha512, "", "3dbUhg7x")`,
+			canonical: `custom(sha512, "", "3dbUhg7x")`,
+			want:      skipError(customhash.New(crypto.SHA512, [][]byte{nil, []byte("3dbUhg7x")})),
+		},
+		{
+			name:      "multi",
+			spec:      "multi( md5 , salt( sha1, \"x\\n\" ) )",
+			canonical: `multi(md5, salt(sha1, "x\n"))`,
+			want:      skipError(multiplehash.New(crypto.MD5.New(), salthash.New(crypto.SHA1.New(), []byte("x\n")))),
+		},
+		{
+			name:      "nested",
+			spec:      `multi(custom(blake2b_256, "a"), salt(multi(sha3_256, murmur3), "b"))`,
+			canonical: `multi(custom(blake2b_256, "a"), salt(multi(sha3_256, murmur3), "b"))`,
+			want: skipError(multiplehash.New(
+				skipError(customhash.New(crypto.BLAKE2b_256, [][]byte{[]byte("a")})),
+				salthash.New(skipError(multiplehash.New(crypto.SHA3_256.New(), murmur3.New128())), []byte("b")),
+			)),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := hashspec.Parse(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.canonical, spec.String())
+
+			// canonical form is parsed to the same spec
+			again, err := hashspec.Parse(spec.String())
+			require.NoError(t, err)
+			assert.Equal(t, spec, again)
+
+			got := spec.New()
+			assert.Equal(t, tt.canonical, got.Spec())
+			assert.Equal(t, tt.want.Size(), got.Size())
+			for _, object := range []string{"", "https://example.com/"} {
+				got.Write([]byte(object))
+				tt.want.Write([]byte(object))
+				assert.Equal(t, tt.want.Sum(nil), got.Sum(nil), object)
+				got.Reset()
+				tt.want.Reset()
+			}
+
+			// a clone hash the same, independently of the original
+			clone := got.Clone()
+			assert.Equal(t, tt.canonical, clone.Spec())
+			got.Write([]byte("https://example.org/"))
+			clone.Write([]byte("https://example.com/"))
+			tt.want.Write([]byte("https://example.com/"))
+			assert.Equal(t, tt.want.Sum(nil), clone.Sum(nil))
+			tt.want.Reset()
+		})
+	}
+}
+
+func TestSpecSeededSalts(t *testing.T) {
+	h, err := hashspec.New(`custom(sha256, salts=4, seed=42)`)
+	require.NoError(t, err)
+	assert.Equal(t, `custom(sha256, salts=4, seed="42")`, h.Spec())
+	assert.Equal(t, 4*32, h.Size())
+
+	// same seed same salts
+	same, err := hashspec.New(h.Spec())
+	require.NoError(t, err)
+	other, err := hashspec.New(`custom(sha256, salts=4, seed="43")`)
+	require.NoError(t, err)
+
+	for _, h := range []hash.Hash{h, same, other} {
+		h.Write([]byte("https://example.com/"))
+	}
+	assert.Equal(t, h.Sum(nil), same.Sum(nil))
+	assert.NotEqual(t, h.Sum(nil), other.Sum(nil))
+}
+
+func TestSpecInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"42",
+		"sha",
+		"sha256(",
+		"sha256()x",
+		"sha256 sha1",
+		"sha256(md5)",
+		"salt(sha1)",
+		`salt(sha1, "x)`,
+		`salt(sha1, x)`,
+		`salt("x", sha1)`,
+		`custom(sha256)`,
+		`custom(murmur3, "a")`,
+		`custom(multi(md5), "a")`,
+		`custom(sha256, salts=0)`,
+		`custom(sha256, salts=2000)`,
+		`custom(sha256, salts="2")`,
+		`custom(sha256, "a", salts=2)`,
+		`custom(sha256, seed="x")`,
+		`custom(sha256, "a", pepper="x")`,
+		`multi()`,
+		`multi("x")`,
+		`multi(md5, 42)`,
+	} {
+		_, err := hashspec.Parse(spec)
+		assert.ErrorIs(t, err, hashspec.ErrInvalidSpec, spec)
+	}
+}
+
+func TestSpecConfig(t *testing.T) {
+	var config struct {
+		Hash hashspec.Spec `json:"hash"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"hash": "multi(md5, salt(sha1, \"x\"))"}`), &config))
+	assert.Equal(t, `multi(md5, salt(sha1, "x"))`, config.Hash.String())
+
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"hash": "multi(md5, salt(sha1, \"x\"))"}`, string(data))
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"hash": "multi()"}`), &config), hashspec.ErrInvalidSpec)
+}
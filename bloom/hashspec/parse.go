@@ -0,0 +1,181 @@
+package hashspec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// call is a parsed expression: name alone, or name(args).
+type call struct {
+	name string
+	args []arg
+	pos  int
+}
+
+// arg is a call argument, positional when key is empty. Its value is either a call or a literal.
+type arg struct {
+	key     string
+	call    *call
+	literal string
+	// quoted is set for string literals, unset for numbers.
+	quoted bool
+	pos    int
+}
+
+// parser is a recursive descent parser of:
+//
+//	expr  = name [ "(" [ arg { "," arg } ] ")" ]
+//	arg   = [ name "=" ] ( expr | string | number )
+type parser struct {
+	s   string
+	pos int
+}
+
+func parse(s string) (*call, error) {
+	p := &parser{s: s}
+	c, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos != len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+
+	return c, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrInvalidSpec, fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek return the next non space byte, 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func isNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_'
+}
+
+// name read a name or a number.
+func (p *parser) name() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && isNameByte(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) expr() (*call, error) {
+	pos := p.pos
+	name := p.name()
+	if name == "" {
+		return nil, p.errorf("expected a name")
+	}
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return nil, p.errorf("expected a name, got %s", name)
+	}
+	c := &call{name: strings.ToLower(name), pos: pos}
+
+	if p.peek() != '(' {
+		return c, nil
+	}
+	p.pos++
+
+	if p.peek() == ')' {
+		p.pos++
+		return c, nil
+	}
+	for {
+		a, err := p.arg()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, a)
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return c, nil
+		default:
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
+
+func (p *parser) arg() (arg, error) {
+	p.skipSpace()
+	a := arg{pos: p.pos}
+
+	if p.peek() == '"' {
+		return p.quoted(a)
+	}
+
+	// key=value, name(...) or number
+	start := p.pos
+	name := p.name()
+	if p.peek() == '=' {
+		p.pos++
+		a.key = strings.ToLower(name)
+		if p.peek() == '"' {
+			return p.quoted(a)
+		}
+		start = p.pos
+		name = p.name()
+	}
+	if name == "" {
+		return a, p.errorf("expected a value")
+	}
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		a.literal = name
+		return a, nil
+	}
+
+	p.pos = start
+	c, err := p.expr()
+	if err != nil {
+		return a, err
+	}
+	a.call = c
+
+	return a, nil
+}
+
+// quoted read a Go string literal.
+func (p *parser) quoted(a arg) (arg, error) {
+	start := p.pos
+	for p.pos++; p.pos < len(p.s) && p.s[p.pos] != '"'; p.pos++ {
+		if p.s[p.pos] == '\\' {
+			p.pos++
+		}
+	}
+	if p.pos >= len(p.s) {
+		p.pos = start
+		return a, p.errorf("unterminated string")
+	}
+	p.pos++
+
+	s, err := strconv.Unquote(p.s[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return a, p.errorf("invalid string: %v", err)
+	}
+	a.literal = s
+	a.quoted = true
+
+	return a, nil
+}
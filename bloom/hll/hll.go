@@ -0,0 +1,222 @@
+package hll
+
+import (
+	"bloom"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/twmb/murmur3"
+)
+
+var (
+	ErrInvalidPrecision = errors.New("invalid precision")
+	ErrHashTooShort     = bloom.ErrHashTooShort
+	ErrIncompatible     = errors.New("incompatible sketches")
+)
+
+const (
+	// MinPrecision and MaxPrecision bound the precision, 16 to 262144 registers.
+	MinPrecision = 4
+	MaxPrecision = 18
+	// registersByWord is the number of 8 bits registers packed in a word, updated with compare and swap.
+	registersByWord = 4
+)
+
+// HyperLogLog estimate the number of distinct objects added (Flajolet et al.) with 2^p registers of 8 bits,
+// the standard error is 1.04/sqrt(2^p): 0.81% with p=14 in 16 KiB.
+// Objects are hashed to 64 bits, the first p bits select a register keeping the longest run of leading zeros
+// seen in the remaining bits. The cardinality is computed with the improved estimator of Ertl
+// ("New cardinality estimation algorithms for HyperLogLog sketches", 2017), free of the bias of the raw
+// estimate at small and large cardinalities without empirical correction tables.
+//
+// Add is lock free with the default murmur3 hash and can be called from many goroutines.
+type HyperLogLog struct {
+	// hashMu serialize the use of hash, unused by the default murmur3.
+	hashMu sync.Mutex
+	hash   hash.Hash
+	// murmur is set when hash is the default murmur3, computed directly without lock nor allocation.
+	murmur bool
+	hashID uint64
+
+	p         uint8
+	registers []atomic.Uint32
+}
+
+// New create a sketch with 2^p registers. Without hash a 128 bits murmur3 is used,
+// hash should produce at least 8 bytes, only the first 8 are used.
+func New(p uint8, hashList ...hash.Hash) (*HyperLogLog, error) {
+	if p < MinPrecision || p > MaxPrecision {
+		return nil, fmt.Errorf("%w: p=%d should be between %d and %d", ErrInvalidPrecision, p, MinPrecision, MaxPrecision)
+	}
+
+	hash, err := bloom.GroupHash(hashList...)
+	if err != nil {
+		return nil, err
+	}
+	if hash.Size() < 8 {
+		return nil, fmt.Errorf("%w: need 8 bytes, hash only produce %d", ErrHashTooShort, hash.Size())
+	}
+
+	return &HyperLogLog{
+		hash:      hash,
+		murmur:    len(hashList) == 0,
+		hashID:    bloom.HashID(hash),
+		p:         p,
+		registers: make([]atomic.Uint32, (1<<p)/registersByWord),
+	}, nil
+}
+
+func (h *HyperLogLog) hashBytes(b []byte) uint64 {
+	if h.murmur {
+		h1, _ := murmur3.Sum128(b)
+		return h1
+	}
+
+	h.hashMu.Lock()
+	defer h.hashMu.Unlock()
+
+	h.hash.Write(b)
+	fp := h.hash.Sum(nil)
+	h.hash.Reset()
+
+	return binary.BigEndian.Uint64(fp)
+}
+
+// Add object to sketch.
+func (h *HyperLogLog) Add(b []byte) {
+	h.add(h.hashBytes(b))
+}
+
+// AddString add s like Add([]byte(s)), without copying it with the default murmur3 hash.
+func (h *HyperLogLog) AddString(s string) {
+	if h.murmur {
+		h1, _ := murmur3.StringSum128(s)
+		h.add(h1)
+		return
+	}
+	h.Add([]byte(s))
+}
+
+// AddFingerprint directly add hash result if already available, it should be at least 8 bytes.
+func (h *HyperLogLog) AddFingerprint(fp []byte) {
+	h.add(binary.BigEndian.Uint64(fp))
+}
+
+// add record the hash x of an object.
+func (h *HyperLogLog) add(x uint64) {
+	i := x >> (64 - h.p)
+	// the sentinel bit bound the rank to 64 - p + 1 when the remaining bits are all 0
+	rank := uint32(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+
+	h.update(i, rank)
+}
+
+// update raise register i to rank.
+func (h *HyperLogLog) update(i uint64, rank uint32) {
+	word := &h.registers[i/registersByWord]
+	shift := 8 * (i % registersByWord)
+	for {
+		old := word.Load()
+		if (old>>shift)&0xff >= rank {
+			return
+		}
+		if word.CompareAndSwap(old, old&^(0xff<<shift)|rank<<shift) {
+			return
+		}
+	}
+}
+
+// register return the value of register i.
+func (h *HyperLogLog) register(i uint64) uint32 {
+	return h.registers[i/registersByWord].Load() >> (8 * (i % registersByWord)) & 0xff
+}
+
+// Count return the estimated number of distinct objects added.
+// Concurrent adds may or may not be counted.
+func (h *HyperLogLog) Count() uint64 {
+	q := 64 - int(h.p)
+	m := float64(uint64(1) << h.p)
+
+	// histogram of register values, from 0 to q + 1
+	c := make([]float64, q+2)
+	for i := uint64(0); i < uint64(1)<<h.p; i++ {
+		c[h.register(i)]++
+	}
+
+	z := m * tau(1-c[q+1]/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + c[k])
+	}
+	z += m * sigma(c[0]/m)
+
+	return uint64(math.Round(m * m / (2 * math.Ln2) / z))
+}
+
+// sigma is σ(x) = x + Σ x^(2^k) 2^(k-1) of Ertl's estimator, correcting registers still at 0.
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+// tau is τ(x) = (1 - x - Σ (1 - x^(2^-k))² 2^-k) / 3 of Ertl's estimator, correcting saturated registers.
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// Merge add the objects of other to h, the sketches should have the same precision and hash configuration.
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.p != other.p || h.hashID != other.hashID {
+		return fmt.Errorf("%w: precision %d and %d, hash %x and %x", ErrIncompatible, h.p, other.p, h.hashID, other.hashID)
+	}
+
+	for i := uint64(0); i < uint64(1)<<h.p; i++ {
+		if rank := other.register(i); rank > 0 {
+			h.update(i, rank)
+		}
+	}
+
+	return nil
+}
+
+// Precision return p, the sketch has 2^p registers.
+func (h *HyperLogLog) Precision() uint8 {
+	return h.p
+}
+
+// ByteSize return the memory used by the registers.
+func (h *HyperLogLog) ByteSize() uint64 {
+	return uint64(len(h.registers)) * 4
+}
@@ -0,0 +1,176 @@
+package hll_test
+
+import (
+	"bloom"
+	"bloom/hll"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/murmur3"
+)
+
+// relativeError return the error of the sketch estimation of n distinct objects.
+func relativeError(h *hll.HyperLogLog, n uint64) float64 {
+	return math.Abs(float64(h.Count())-float64(n)) / float64(n)
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        uint8
+		hashList []hash.Hash
+		n        uint64
+		maxError float64
+	}{
+		{
+			name:     "1M distinct",
+			p:        14,
+			n:        1000000,
+			maxError: 0.02,
+		},
+		{
+			name:     "1M distinct sha256",
+			p:        14,
+			hashList: []hash.Hash{sha256.New()},
+			n:        1000000,
+			maxError: 0.02,
+		},
+		{
+			name:     "1M distinct max precision",
+			p:        hll.MaxPrecision,
+			n:        1000000,
+			maxError: 0.01,
+		},
+		{
+			name:     "small cardinality",
+			p:        14,
+			n:        100,
+			maxError: 0.02,
+		},
+		{
+			name:     "min precision",
+			p:        hll.MinPrecision,
+			n:        10000,
+			maxError: 0.5,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := hll.New(tt.p, tt.hashList...)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(0), h.Count())
+			assert.Equal(t, uint64(1)<<tt.p, h.ByteSize())
+
+			for i := uint64(0); i < tt.n; i++ {
+				h.AddString(fmt.Sprintf("https://example.com/%d", i))
+			}
+			// duplicates are not counted
+			for i := uint64(0); i < tt.n; i += 10 {
+				h.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+
+			t.Logf("estimated %d for %d", h.Count(), tt.n)
+			assert.Less(t, relativeError(h, tt.n), tt.maxError)
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, p := range []uint8{0, hll.MinPrecision - 1, hll.MaxPrecision + 1} {
+		_, err := hll.New(p)
+		assert.ErrorIs(t, err, hll.ErrInvalidPrecision, p)
+	}
+
+	_, err := hll.New(14, murmur3.New32())
+	assert.ErrorIs(t, err, hll.ErrHashTooShort)
+	assert.ErrorIs(t, err, bloom.ErrHashTooShort, "shared with the bloom package")
+}
+
+func TestAddFingerprint(t *testing.T) {
+	h, err := hll.New(14)
+	require.NoError(t, err)
+	other, err := hll.New(14)
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		object := []byte(fmt.Sprintf("https://example.com/%d", i))
+		h.Add(object)
+
+		m := murmur3.New128()
+		m.Write(object)
+		other.AddFingerprint(m.Sum(nil))
+	}
+	assert.Equal(t, h.Count(), other.Count())
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	n := 100000
+	workers := 8
+
+	h, err := hll.New(14)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// every worker add all objects in its own order
+			for i := 0; i < n; i++ {
+				h.AddString(fmt.Sprintf("https://example.com/%d", (i+w*n/workers)%n))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	serial, err := hll.New(14)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		serial.AddString(fmt.Sprintf("https://example.com/%d", i))
+	}
+	assert.Equal(t, serial.Count(), h.Count())
+	assert.Less(t, relativeError(h, uint64(n)), 0.02)
+}
+
+func TestMerge(t *testing.T) {
+	a, err := hll.New(14)
+	require.NoError(t, err)
+	b, err := hll.New(14)
+	require.NoError(t, err)
+
+	for i := 0; i < 60000; i++ {
+		a.AddString(fmt.Sprintf("https://example.com/%d", i))
+	}
+	for i := 40000; i < 100000; i++ {
+		b.AddString(fmt.Sprintf("https://example.com/%d", i))
+	}
+	require.NoError(t, a.Merge(b))
+	assert.Less(t, relativeError(a, 100000), 0.02)
+
+	other, err := hll.New(12)
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.Merge(other), hll.ErrIncompatible)
+	other, err = hll.New(14, sha256.New())
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.Merge(other), hll.ErrIncompatible)
+}
+
+func BenchmarkAdd(b *testing.B) {
+	h, err := hll.New(14)
+	require.NoError(b, err)
+	object := []byte("https://example.com/")
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h.Add(object)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package bloom
+
+import (
+	"bloom/hashspec"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/twmb/murmur3"
+)
+
+// check interface implementation
+var (
+	_ Filter        = &mappedFilter{}
+	_ BatchFilter   = &mappedFilter{}
+	_ io.ReaderFrom = &mappedFilter{}
+	_ io.Closer     = &mappedFilter{}
+)
+
+var ErrMmapUnsupported = errors.New("memory mapping unsupported")
+
+// mappedHeaderSize is the size of a mapped file header without hash spec, bits start on a 64 bytes boundary.
+const mappedHeaderSize = 64
+
+var mappedMagic = [4]byte{'B', 'L', 'M', 'M'}
+
+// mappedFilter is a filter whose bits live in a memory mapped file instead of the heap.
+//
+// Layout (big endian):
+//
+//	magic "BLMM" | version uint8 | strategy uint8 | hashID uint64 | m uint64 | k uint64 | count uint64 | padding | bits
+//
+// Filters created with a hashspec.Hash are version 2 and embed their hash spec after the header,
+// the bits start on the next 64 bytes boundary:
+//
+//	... | count uint64 | spec length uint16 | spec | padding | bits
+//
+// Opening a file map it without reading it, the kernel load pages on access and share them with every process
+// mapping the same file: bits set by one are seen immediately by the others.
+// Bits are only guaranteed on disk and the count in the header updated by Flush, called at checkpoints.
+// The filter lock is per process, a single process should add to a file while others look up.
+type mappedFilter struct {
+	*filter
+	// mapMu protect the mapping from Close during Flush.
+	mapMu sync.RWMutex
+	file  *os.File
+	data  []byte // whole mapped file, header then bits
+}
+
+// CreateMapped create a filter sized like NewDoubleHashing backed by a new file at path, an existing file is never overwritten.
+// Without hash a 128 bits murmur3 is used.
+func CreateMapped(path string, n uint64, fpRate float64, hashList ...hash.Hash) (*mappedFilter, error) {
+	hash, m, k, err := estimate(strategyDoubleHashing, n, fpRate, hashList...)
+	if err != nil {
+		return nil, err
+	}
+	f := newFilterWithBits(hash, strategyDoubleHashing, m, k, nil)
+	f.murmur = len(hashList) == 0
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize, mappedHeaderSize)
+	f.putHeader(header, mappedMagic)
+	if f.spec != "" {
+		header[4] = formatVersionSpec
+		if header, err = appendSpec(header, f.spec); err != nil {
+			file.Close()
+			os.Remove(path)
+			return nil, err
+		}
+	}
+
+	offset := mappedBitsOffset(len(header))
+	size := offset + int64(f.strategy.size(m))
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	mf, err := mapFilter(f, file, offset, size)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	copy(mf.data, header)
+	return mf, mf.Flush()
+}
+
+// mappedBitsOffset return the offset of the bits after a header of headerLen bytes, on a 64 bytes boundary.
+func mappedBitsOffset(headerLen int) int64 {
+	return int64(headerLen+mappedHeaderSize-1) / mappedHeaderSize * mappedHeaderSize
+}
+
+// OpenMapped open a file created by CreateMapped, bits are not read.
+// The filter should be opened with the hash configuration it was created with. Without hash, the hash of
+// a filter created with a hashspec.Hash is rebuilt from its embedded spec, otherwise a 128 bits murmur3 is used.
+func OpenMapped(path string, hashList ...hash.Hash) (*mappedFilter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f, offset, size, err := readMappedHeader(file, hashList...)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return mapFilter(f, file, offset, size)
+}
+
+// readMappedHeader return the filter configured by the header of file, the offset of its bits and the expected file size.
+func readMappedHeader(file *os.File, hashList ...hash.Hash) (*filter, int64, int64, error) {
+	r := &countReader{r: file}
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, 0, readError(err)
+	}
+	if !bytes.Equal(header[:4], mappedMagic[:]) {
+		return nil, 0, 0, ErrInvalidFormat
+	}
+	if header[4] != formatVersion && header[4] != formatVersionSpec {
+		return nil, 0, 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header[4])
+	}
+
+	s := strategy(header[5])
+	id := binary.BigEndian.Uint64(header[6:])
+	m := binary.BigEndian.Uint64(header[14:])
+	k := binary.BigEndian.Uint64(header[22:])
+	count := binary.BigEndian.Uint64(header[30:])
+
+	if s > strategyBlocked {
+		return nil, 0, 0, fmt.Errorf("%w: strategy %d", ErrInvalidFormat, s)
+	}
+	var spec string
+	if header[4] == formatVersionSpec {
+		var err error
+		if spec, err = readSpec(r); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	murmur := false
+	switch {
+	case len(hashList) > 0:
+	case spec != "":
+		h, err := hashspec.New(spec)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		hashList = []hash.Hash{h}
+	default:
+		murmur = s == strategyDoubleHashing || s == strategyBlocked
+		hashList = []hash.Hash{murmur3.New128()}
+	}
+	hash, err := GroupHash(hashList...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	f := newFilterWithBits(hash, s, m, k, nil)
+	f.murmur = murmur
+	f.count = count
+	if id != f.hashID {
+		return nil, 0, 0, ErrHashMismatch
+	}
+	if err := f.validate(m, k); err != nil {
+		return nil, 0, 0, err
+	}
+
+	offset := mappedBitsOffset(int(r.n))
+	size := offset + int64(s.size(m))
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if info.Size() != size {
+		return nil, 0, 0, fmt.Errorf("%w: file is %d bytes, expected %d", ErrInvalidFormat, info.Size(), size)
+	}
+
+	return f, offset, size, nil
+}
+
+// mapFilter map size bytes of file, the bits of f starting at offset, file is closed on error.
+func mapFilter(f *filter, file *os.File, offset, size int64) (*mappedFilter, error) {
+	data, err := mmap(file, int(size))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.fingerprint = data[offset:]
+
+	return &mappedFilter{
+		filter: f,
+		file:   file,
+		data:   data,
+	}, nil
+}
+
+// Flush write the count in the header and synchronously write modified pages to the file (msync).
+func (f *mappedFilter) Flush() error {
+	f.mapMu.RLock()
+	defer f.mapMu.RUnlock()
+
+	return f.flush()
+}
+
+// flush is Flush with mapMu held.
+func (f *mappedFilter) flush() error {
+	if f.data == nil {
+		return os.ErrClosed
+	}
+
+	f.mu.Lock()
+	binary.BigEndian.PutUint64(f.data[30:], f.count)
+	f.mu.Unlock()
+
+	return msync(f.data)
+}
+
+// Close flush and unmap the filter, it must not be used afterwards.
+func (f *mappedFilter) Close() error {
+	f.mapMu.Lock()
+	defer f.mapMu.Unlock()
+
+	err := f.flush()
+	if errors.Is(err, os.ErrClosed) {
+		return err
+	}
+
+	f.mu.Lock()
+	f.fingerprint = nil // later use panic instead of faulting on unmapped memory
+	f.mu.Unlock()
+
+	if unmapErr := munmap(f.data); err == nil {
+		err = unmapErr
+	}
+	f.data = nil
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// UnmarshalBinary load a filter encoded by MarshalBinary in the mapped bits, see ReadFrom.
+func (f *mappedFilter) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(f, data)
+}
+
+// ReadFrom load a filter streamed by WriteTo from r in the mapped bits.
+// The filter should have been created with the same hash configuration and size.
+func (f *mappedFilter) ReadFrom(r io.Reader) (int64, error) {
+	// hash is only used for its size, never written
+	loaded := &filter{hash: f.hash, strategy: f.strategy, hashID: f.hashID}
+	n, err := loaded.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if loaded.m != f.m || loaded.k != f.k {
+		return n, fmt.Errorf("%w: m=%d k=%d, mapped filter has m=%d k=%d", ErrInvalidFormat, loaded.m, loaded.k, f.m, f.k)
+	}
+	copy(f.fingerprint, loaded.fingerprint)
+	f.count = loaded.count
+
+	return n, nil
+}
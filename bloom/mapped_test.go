@@ -0,0 +1,176 @@
+package bloom_test
+
+import (
+	"bloom"
+	"bloom/hashspec"
+	"crypto"
+	_ "crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	n := 10000
+
+	filter, err := bloom.CreateMapped(path, uint64(n), 0.01)
+	require.NoError(t, err)
+
+	// another mapping of the same file see bits as soon as they are set
+	reader, err := bloom.OpenMapped(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	for i := 0; i < n; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	for i := 0; i < n; i++ {
+		require.True(t, reader.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+	}
+
+	// count is only updated at checkpoints
+	require.NoError(t, filter.Flush())
+	require.NoError(t, filter.Close())
+	assert.ErrorIs(t, filter.Close(), os.ErrClosed)
+
+	reopened, err := bloom.OpenMapped(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	assert.Equal(t, uint64(n), reopened.Stats().Count)
+	falsePositive := 0
+	for i := 0; i < n; i++ {
+		require.True(t, reopened.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+		if reopened.Contain([]byte(fmt.Sprintf("https://example.org/%d", i))) {
+			falsePositive++
+		}
+	}
+	assert.Less(t, float64(falsePositive)/float64(n), 0.015, "false positive rate")
+
+	// same bits as a heap filter
+	heap, err := bloom.NewDoubleHashing(uint64(n), 0.01)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		heap.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	assert.Equal(t, heap.String(), reopened.String())
+}
+
+func TestMappedFilterSpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.bloom")
+	spec, err := hashspec.Parse(`multi(custom(sha512, salts=2, seed="s"), salt(murmur3, "x"))`)
+	require.NoError(t, err)
+
+	filter, err := bloom.CreateMapped(path, 1000, 0.01, spec.New())
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+	require.NoError(t, filter.Close())
+
+	// the hash is rebuilt from the embedded spec
+	reopened, err := bloom.OpenMapped(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.True(t, reopened.Contain([]byte("https://example.com/")))
+	assert.Equal(t, uint64(1), reopened.Stats().Count)
+
+	same, err := bloom.OpenMapped(path, spec.New())
+	require.NoError(t, err)
+	defer same.Close()
+	assert.True(t, same.Contain([]byte("https://example.com/")))
+
+	_, err = bloom.OpenMapped(path, crypto.SHA256.New())
+	assert.ErrorIs(t, err, bloom.ErrHashMismatch)
+}
+
+func TestMappedFilterUnmarshal(t *testing.T) {
+	n := uint64(1000)
+	heap, err := bloom.NewDoubleHashing(n, 0.01)
+	require.NoError(t, err)
+	heap.Add([]byte("https://example.com/"))
+	data, err := heap.MarshalBinary()
+	require.NoError(t, err)
+
+	filter, err := bloom.CreateMapped(filepath.Join(t.TempDir(), "filter.bloom"), n, 0.01)
+	require.NoError(t, err)
+	defer filter.Close()
+
+	require.NoError(t, filter.UnmarshalBinary(data))
+	assert.True(t, filter.Contain([]byte("https://example.com/")))
+	assert.Equal(t, uint64(1), filter.Stats().Count)
+
+	// the mapping can not be resized
+	other, err := bloom.NewDoubleHashing(2*n, 0.01)
+	require.NoError(t, err)
+	data, err = other.MarshalBinary()
+	require.NoError(t, err)
+	assert.ErrorIs(t, filter.UnmarshalBinary(data), bloom.ErrInvalidFormat)
+	assert.True(t, filter.Contain([]byte("https://example.com/")))
+}
+
+func TestMappedFilterInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filter.bloom")
+
+	filter, err := bloom.CreateMapped(path, 1000, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, filter.Close())
+
+	_, err = bloom.CreateMapped(path, 1000, 0.01)
+	assert.ErrorIs(t, err, os.ErrExist, "never overwrite")
+
+	_, err = bloom.OpenMapped(path, crypto.MD5.New(), crypto.MD5.New())
+	assert.ErrorIs(t, err, bloom.ErrHashMismatch)
+
+	_, err = bloom.OpenMapped(filepath.Join(dir, "missing.bloom"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{
+			name: "truncated header",
+			data: data[:10],
+			err:  bloom.ErrInvalidFormat,
+		},
+		{
+			name: "truncated bits",
+			data: data[:len(data)-1],
+			err:  bloom.ErrInvalidFormat,
+		},
+		{
+			name: "magic",
+			data: append([]byte("BLMF"), data[4:]...),
+			err:  bloom.ErrInvalidFormat,
+		},
+		{
+			name: "version",
+			data: append(append([]byte{}, data[:4]...), append([]byte{99}, data[5:]...)...),
+			err:  bloom.ErrUnsupportedVersion,
+		},
+		{
+			name: "positions",
+			data: append(append(append([]byte{}, data[:22]...), 0, 0, 0, 4, 0, 0, 0, 0), data[30:]...),
+			err:  bloom.ErrInvalidFormat,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".bloom")
+			require.NoError(t, os.WriteFile(path, tt.data, 0o644))
+
+			_, err := bloom.OpenMapped(path)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
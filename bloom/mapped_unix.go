@@ -0,0 +1,23 @@
+//go:build unix
+
+package bloom
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmap map size bytes of file, shared with other processes.
+func mmap(file *os.File, size int) ([]byte, error) {
+	return unix.Mmap(int(file.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	return unix.Munmap(data)
+}
+
+// msync write modified pages of data to the file and wait for completion.
+func msync(data []byte) error {
+	return unix.Msync(data, unix.MS_SYNC)
+}
@@ -1,13 +1,10 @@
 package multiplehash
 
 import (
-	"bytes"
 	"errors"
 	"hash"
 	"sync"
 	"sync/atomic"
-
-	"golang.org/x/sync/errgroup"
 )
 
 // check that we implement the interface.
@@ -17,8 +14,7 @@ var (
 	ErrInvalidHashList = errors.New("invalid hash list")
 )
 
-// MultipleHash implement hash.Hash interface over multiple hash to ease composition of bloom filter
-// it try to leverage at most multi-thread.
+// MultipleHash implement hash.Hash interface over multiple hash to ease composition of bloom filter.
 type MultipleHash struct {
 	hashList []hash.Hash
 	indexes  []uint64 // help respond more quickly on some method by storing position of each hash
@@ -45,53 +41,34 @@ func New(hashList ...hash.Hash) (*MultipleHash, error) {
 
 // Write (via the embedded io.Writer interface) adds more data to the running hash.
 // It never returns an error.
+// Hashes are run one after the other: objects are short, starting goroutines cost more than hashing them.
 func (m *MultipleHash) Write(p []byte) (int, error) {
-	g := new(errgroup.Group)
-	n := new(atomic.Int64) // AGI probably lead to overflow in some platform but should not be a problem
-
+	n := 0
 	for _, h := range m.hashList {
-		h := h
-		g.Go(func() error {
-			nLocal, err := h.Write(p)
-			n.Add(int64(nLocal))
-			return err
-		})
+		nLocal, err := h.Write(p)
+		if err != nil {
+			return n / m.numberHash, err
+		}
+		n += nLocal
 	}
-	err := g.Wait()
 
-	return int(n.Load()) / m.numberHash, err
+	return n / m.numberHash, nil
 }
 
 // Sum appends the current hash to b and returns the resulting slice.
 // It does not change the underlying hash state.
 func (m *MultipleHash) Sum(b []byte) []byte {
-	bList := make([][]byte, m.numberHash)
-	var wg sync.WaitGroup
-	wg.Add(m.numberHash)
-	for i, h := range m.hashList {
-		i, h := i, h
-		go func() {
-			bList[i] = h.Sum(b)
-			wg.Done()
-		}()
+	for _, h := range m.hashList {
+		b = h.Sum(b)
 	}
-	wg.Wait()
-
-	return bytes.Join(bList, nil)
+	return b
 }
 
 // Reset resets the Hash to its initial state.
 func (m *MultipleHash) Reset() {
-	var wg sync.WaitGroup
-	wg.Add(m.numberHash)
 	for _, h := range m.hashList {
-		h := h
-		go func() {
-			h.Reset()
-			wg.Done()
-		}()
+		h.Reset()
 	}
-	wg.Wait()
 }
 
 // Size returns the number of bytes Sum will return.
@@ -122,6 +122,18 @@ func TestMultipleHash(t *testing.T) {
 	}
 }
 
+func TestMultipleHashSumAppend(t *testing.T) {
+	h, err := multiplehash.New(crypto.MD5.New(), crypto.SHA512.New())
+	require.NoError(t, err)
+	h.Write([]byte("some_random_string"))
+
+	sum := h.Sum(nil)
+	prefix := []byte("prefix")
+	buf := make([]byte, len(prefix), 128) // spare capacity must not be shared by hashes
+	copy(buf, prefix)
+	assert.Equal(t, append(prefix, sum...), h.Sum(buf))
+}
+
 func BenchmarkMultipleHash(b *testing.B) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,69 @@
+package bloom
+
+import "encoding/binary"
+
+// BlockBits is the number of bits of a blocked filter block, the size of a 64 bytes cache line.
+const BlockBits = 512
+
+// maxStackPositions is the number of positions that can be computed without allocation.
+const maxStackPositions = 32
+
+// strategy define how bit positions are derived from a fingerprint.
+type strategy uint8
+
+const (
+	// strategyDigest OR the whole fingerprint into the filter.
+	strategyDigest strategy = iota
+	// strategyChunk read each position as a 32 bits chunk of the fingerprint.
+	strategyChunk
+	// strategyDoubleHashing derive positions as h1 + i*h2 from the first 128 bits of the fingerprint.
+	strategyDoubleHashing
+	// strategyBlocked select a 512 bits block with h1 and read all positions inside it as 9 bits chunks of h2.
+	strategyBlocked
+)
+
+// size return the number of bytes needed to store m bits.
+func (s strategy) size(m uint64) uint64 {
+	if s == strategyDigest {
+		return m / 8
+	}
+	return bitsToBytes(m)
+}
+
+// positions append the k bit positions of fingerprint fp in a m bits array to dst.
+func (s strategy) positions(dst []uint64, fp []byte, m, k uint64) []uint64 {
+	switch s {
+	case strategyChunk:
+		for i := uint64(0); i < k; i++ {
+			dst = append(dst, uint64(binary.BigEndian.Uint32(fp[i*4:]))%m)
+		}
+	case strategyDoubleHashing:
+		h1 := binary.BigEndian.Uint64(fp)
+		h2 := binary.BigEndian.Uint64(fp[8:])
+		for i := uint64(0); i < k; i++ {
+			dst = append(dst, (h1+i*h2)%m)
+		}
+	case strategyBlocked:
+		block := binary.BigEndian.Uint64(fp) % (m / BlockBits) * BlockBits
+		h := binary.BigEndian.Uint64(fp[8:])
+		// each 64 bits give 7 positions of 9 bits, remix once consumed
+		for i := uint64(0); i < k; i++ {
+			if i%7 == 0 && i > 0 {
+				h = Mix64(h)
+			}
+			dst = append(dst, block+(h>>(9*(i%7)))%BlockBits)
+		}
+	}
+
+	return dst
+}
+
+// Mix64 is the splitmix64 finalizer, spreading the bits of x over the whole result.
+func Mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package bloom_test
+
+// raceEnabled is set when tests run with the race detector, sync.Pool then drop items at random and allocate.
+const raceEnabled = true
@@ -0,0 +1,360 @@
+package registry
+
+import (
+	"bloom"
+	"container/list"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+	"sync/atomic"
+)
+
+// Key identify the filter of a user in a tenant.
+type Key struct {
+	TenantID string
+	UserID   string
+}
+
+func (k Key) String() string {
+	return k.TenantID + "/" + k.UserID
+}
+
+// Filter is a bloom.Filter reporting its memory use that can be saved to a Store.
+type Filter interface {
+	bloom.Filter
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	ByteSize() uint64
+}
+
+// Template create the empty filter of a key seen for the first time.
+// Each call should return a filter with its own hash as filters are used concurrently.
+type Template func() (Filter, error)
+
+// DoubleHashing return a template of bloom.NewDoubleHashing filters, newHash create the hash list of each filter.
+// Without newHash a 128 bits murmur3 is used.
+func DoubleHashing(n uint64, fpRate float64, newHash func() []hash.Hash) Template {
+	return func() (Filter, error) {
+		var hashList []hash.Hash
+		if newHash != nil {
+			hashList = newHash()
+		}
+		return bloom.NewDoubleHashing(n, fpRate, hashList...)
+	}
+}
+
+// Sparse return a template of bloom.NewSparse filters, small while their user added few objects.
+// A sparse filter grow up to the size of a double hashing one.
+// Without newHash a 128 bits murmur3 is used.
+func Sparse(n uint64, fpRate float64, newHash func() []hash.Hash) Template {
+	return func() (Filter, error) {
+		var hashList []hash.Hash
+		if newHash != nil {
+			hashList = newHash()
+		}
+		return bloom.NewSparse(n, fpRate, hashList...)
+	}
+}
+
+// Stats are the counters of a Registry.
+type Stats struct {
+	// Hits is the number of lookups of a filter in memory.
+	Hits uint64
+	// Misses is the number of lookups creating a filter or loading it from the store.
+	Misses uint64
+	// Loads is the number of misses that found the filter in the store.
+	Loads uint64
+	// Evictions is the number of filters removed from memory.
+	Evictions uint64
+	// SpillErrors is the number of evictions aborted because the store failed, the filter stay in memory.
+	SpillErrors uint64
+	// Filters is the number of filters in memory.
+	Filters int
+	// Bytes is the memory used by filters in memory.
+	Bytes uint64
+}
+
+// Registry map each tenant and user to its own filter. Filters are created lazily from a template
+// and the least recently used are evicted to a store once the memory of all filters exceed a budget.
+// Filters growing after creation (sparse, scalable) are accounted again after each add.
+type Registry struct {
+	mu       sync.Mutex
+	template Template
+	maxBytes uint64
+	store    Store
+	entries  map[Key]*entry
+	// spilling are the evicted entries being saved to the store, lookups of their key wait until saved.
+	spilling map[Key]*entry
+	lru      *list.List // of *entry, most recently used first
+	stats    Stats
+}
+
+// entry is the filter of a key, the filter is nil while loading and once evicted.
+type entry struct {
+	// mu is held for reading while filter is used and for writing while it is evicted.
+	mu     sync.RWMutex
+	key    Key
+	filter Filter
+	// size is written under the registry lock and read without it by adds.
+	size atomic.Uint64
+	elem *list.Element
+	// ready is closed once filter is loaded or err set.
+	ready chan struct{}
+	err   error
+	// spilled is closed once the evicted filter is saved, or back in the registry if saving failed.
+	spilled chan struct{}
+}
+
+// New create a registry of filters created by template using at most maxBytes, 0 is unlimited.
+// Evicted filters are saved in store and loaded back on next use, with a nil store they are dropped.
+func New(template Template, maxBytes uint64, store Store) *Registry {
+	return &Registry{
+		template: template,
+		maxBytes: maxBytes,
+		store:    store,
+		entries:  make(map[Key]*entry),
+		spilling: make(map[Key]*entry),
+		lru:      list.New(),
+	}
+}
+
+// Add add object to the filter of key.
+func (r *Registry) Add(key Key, b []byte) error {
+	return r.add(key, func(f Filter) {
+		f.Add(b)
+	})
+}
+
+// AddFingerprint add fingerprint to the filter of key.
+func (r *Registry) AddFingerprint(key Key, fp []byte) error {
+	return r.add(key, func(f Filter) {
+		f.AddFingerprint(fp)
+	})
+}
+
+// add call fn with the filter of key like use then account its new size if it grew.
+func (r *Registry) add(key Key, fn func(Filter)) error {
+	var size uint64
+	e, err := r.use(key, func(f Filter) {
+		fn(f)
+		size = f.ByteSize()
+	})
+	if err != nil {
+		return err
+	}
+	if size != e.size.Load() {
+		r.resize(e)
+	}
+
+	return nil
+}
+
+// resize account the current size of the filter of e and evict filters over budget.
+func (r *Registry) resize(e *entry) {
+	r.mu.Lock()
+	// the filter is only evicted once removed from entries under r.mu
+	if r.entries[e.key] != e || e.filter == nil {
+		r.mu.Unlock()
+		return
+	}
+	size := e.filter.ByteSize()
+	r.stats.Bytes = r.stats.Bytes - e.size.Load() + size
+	e.size.Store(size)
+
+	victims := r.evict()
+	r.mu.Unlock()
+
+	r.spill(victims)
+}
+
+// Contain return if object is probably in the filter of key.
+func (r *Registry) Contain(key Key, b []byte) (bool, error) {
+	var contained bool
+	_, err := r.use(key, func(f Filter) {
+		contained = f.Contain(b)
+	})
+	return contained, err
+}
+
+// ContainFingerprint return if fingerprint is probably in the filter of key.
+func (r *Registry) ContainFingerprint(key Key, fp []byte) (bool, error) {
+	var contained bool
+	_, err := r.use(key, func(f Filter) {
+		contained = f.ContainFingerprint(fp)
+	})
+	return contained, err
+}
+
+// Stats return a snapshot of the registry counters.
+func (r *Registry) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	stats.Filters = len(r.entries)
+	return stats
+}
+
+// use call fn with the filter of key and return its entry, the filter can not be evicted during the call.
+func (r *Registry) use(key Key, fn func(Filter)) (*entry, error) {
+	for {
+		e, err := r.acquire(key)
+		if err != nil {
+			return nil, err
+		}
+
+		e.mu.RLock()
+		if e.filter != nil {
+			fn(e.filter)
+			e.mu.RUnlock()
+			return e, nil
+		}
+		// evicted between lookup and use
+		e.mu.RUnlock()
+	}
+}
+
+// acquire return the loaded entry of key, creating or loading its filter on miss.
+func (r *Registry) acquire(key Key) (*entry, error) {
+	r.mu.Lock()
+	for {
+		spilling, ok := r.spilling[key]
+		if !ok {
+			break
+		}
+		// load the filter once saved, or use it again if saving failed
+		r.mu.Unlock()
+		<-spilling.spilled
+		r.mu.Lock()
+	}
+
+	if e, ok := r.entries[key]; ok {
+		r.stats.Hits++
+		r.lru.MoveToFront(e.elem)
+		r.mu.Unlock()
+
+		<-e.ready
+		return e, e.err
+	}
+
+	r.stats.Misses++
+	e := &entry{key: key, ready: make(chan struct{})}
+	e.elem = r.lru.PushFront(e)
+	r.entries[key] = e
+	r.mu.Unlock()
+
+	// load without blocking other keys, lookups of key wait on ready
+	filter, loaded, err := r.load(key)
+
+	r.mu.Lock()
+	if err != nil {
+		e.err = err
+		r.lru.Remove(e.elem)
+		delete(r.entries, key)
+		close(e.ready)
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	e.filter = filter
+	e.size.Store(filter.ByteSize())
+	r.stats.Bytes += e.size.Load()
+	if loaded {
+		r.stats.Loads++
+	}
+	close(e.ready)
+
+	victims := r.evict()
+	r.mu.Unlock()
+
+	r.spill(victims)
+
+	return e, nil
+}
+
+// load create the filter of key from the template and load it from the store if it was evicted.
+func (r *Registry) load(key Key) (Filter, bool, error) {
+	filter, err := r.template()
+	if err != nil {
+		return nil, false, err
+	}
+	if r.store == nil {
+		return filter, false, nil
+	}
+
+	data, err := r.store.Load(key)
+	if errors.Is(err, ErrNotFound) {
+		return filter, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("load %s: %w", key, err)
+	}
+	if err := filter.UnmarshalBinary(data); err != nil {
+		return nil, false, fmt.Errorf("load %s: %w", key, err)
+	}
+
+	return filter, true, nil
+}
+
+// evict remove least recently used filters from the registry until memory is under budget and return them
+// to spill once r.mu is released, the most recent one is always kept. Lookups of their keys wait until spilled.
+func (r *Registry) evict() []*entry {
+	if r.maxBytes == 0 {
+		return nil
+	}
+
+	var victims []*entry
+	elem := r.lru.Back()
+	for r.stats.Bytes > r.maxBytes && elem != nil && elem != r.lru.Front() {
+		e := elem.Value.(*entry)
+		elem = elem.Prev()
+
+		select {
+		case <-e.ready:
+		default: // still loading
+			continue
+		}
+
+		r.lru.Remove(e.elem)
+		delete(r.entries, e.key)
+		r.stats.Bytes -= e.size.Load()
+		e.spilled = make(chan struct{})
+		r.spilling[e.key] = e
+		victims = append(victims, e)
+	}
+
+	return victims
+}
+
+// spill save evicted filters to the store without holding r.mu, filters failing to save are put back in the registry.
+func (r *Registry) spill(victims []*entry) {
+	for _, e := range victims {
+		// wait for calls using the filter
+		e.mu.Lock()
+		var err error
+		if r.store != nil {
+			var data []byte
+			data, err = e.filter.MarshalBinary()
+			if err == nil {
+				err = r.store.Save(e.key, data)
+			}
+		}
+
+		r.mu.Lock()
+		delete(r.spilling, e.key)
+		if err != nil {
+			r.stats.SpillErrors++
+			e.elem = r.lru.PushBack(e)
+			r.entries[e.key] = e
+			r.stats.Bytes += e.size.Load()
+		} else {
+			e.filter = nil
+			r.stats.Evictions++
+		}
+		close(e.spilled)
+		r.mu.Unlock()
+		e.mu.Unlock()
+	}
+}
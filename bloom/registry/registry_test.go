@@ -0,0 +1,264 @@
+package registry_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"bloom/registry"
+)
+
+func userKey(i int) registry.Key {
+	return registry.Key{TenantID: fmt.Sprintf("t-%d", i%5), UserID: fmt.Sprintf("u-%d", i)}
+}
+
+func TestRegistry(t *testing.T) {
+	template := registry.DoubleHashing(1000, 0.01, nil)
+	filter, err := template()
+	require.NoError(t, err)
+	filterSize := filter.ByteSize()
+
+	tests := []struct {
+		name  string
+		store registry.Store
+	}{
+		{
+			name: "no store",
+		},
+		{
+			name:  "memory",
+			store: registry.NewMemoryStore(),
+		},
+		{
+			name:  "dir",
+			store: registry.NewDirStore(t.TempDir()),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := registry.New(template, 3*filterSize, tt.store)
+
+			for i := 0; i < 10; i++ {
+				require.NoError(t, r.Add(userKey(i), []byte(fmt.Sprintf("https://example.com/%d", i))))
+			}
+			stats := r.Stats()
+			assert.Equal(t, registry.Stats{Misses: 10, Evictions: 7, Filters: 3, Bytes: 3 * filterSize}, stats)
+
+			// filters are isolated
+			contained, err := r.Contain(userKey(9), []byte("https://example.com/8"))
+			require.NoError(t, err)
+			assert.False(t, contained)
+
+			// most recent filters are in memory
+			for i := 7; i < 10; i++ {
+				contained, err := r.Contain(userKey(i), []byte(fmt.Sprintf("https://example.com/%d", i)))
+				require.NoError(t, err)
+				assert.True(t, contained)
+			}
+			assert.Equal(t, uint64(4), r.Stats().Hits, "isolation check and 3 lookups")
+
+			// evicted filters are loaded back from the store
+			contained, err = r.Contain(userKey(0), []byte("https://example.com/0"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.store != nil, contained)
+
+			stats = r.Stats()
+			assert.Equal(t, uint64(11), stats.Misses)
+			assert.Equal(t, uint64(8), stats.Evictions)
+			if tt.store != nil {
+				assert.Equal(t, uint64(1), stats.Loads)
+			}
+		})
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	template := registry.DoubleHashing(100, 0.01, nil)
+	filter, err := template()
+	require.NoError(t, err)
+
+	users := 1000
+	r := registry.New(template, 100*filter.ByteSize(), registry.NewMemoryStore())
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 10*users; i += 8 {
+				assert.NoError(t, r.Add(userKey(i%users), []byte(fmt.Sprintf("https://example.com/%d", i))))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// no object lost by evictions
+	for i := 0; i < 10*users; i++ {
+		contained, err := r.Contain(userKey(i%users), []byte(fmt.Sprintf("https://example.com/%d", i)))
+		require.NoError(t, err)
+		require.True(t, contained, "false negative")
+	}
+
+	stats := r.Stats()
+	assert.LessOrEqual(t, stats.Filters, 100)
+	assert.Greater(t, stats.Evictions, uint64(0))
+	assert.Equal(t, stats.Misses, stats.Evictions+uint64(stats.Filters))
+}
+
+func TestRegistryTemplateError(t *testing.T) {
+	r := registry.New(registry.DoubleHashing(0, 0.01, nil), 0, nil)
+
+	assert.Error(t, r.Add(userKey(0), []byte("https://example.com/")))
+	// the failed key is retried
+	assert.Error(t, r.Add(userKey(0), []byte("https://example.com/")))
+	assert.Equal(t, registry.Stats{Misses: 2}, r.Stats())
+}
+
+// failingStore refuse to save.
+type failingStore struct {
+	registry.MemoryStore
+}
+
+func (s *failingStore) Save(registry.Key, []byte) error {
+	return errors.New("store unavailable")
+}
+
+func TestRegistrySpillError(t *testing.T) {
+	template := registry.DoubleHashing(1000, 0.01, nil)
+	filter, err := template()
+	require.NoError(t, err)
+
+	r := registry.New(template, filter.ByteSize(), &failingStore{})
+	require.NoError(t, r.Add(userKey(0), []byte("https://example.com/0")))
+	require.NoError(t, r.Add(userKey(1), []byte("https://example.com/1")))
+
+	// the filter is kept in memory over budget
+	stats := r.Stats()
+	assert.Equal(t, uint64(1), stats.SpillErrors)
+	assert.Equal(t, 2, stats.Filters)
+	contained, err := r.Contain(userKey(0), []byte("https://example.com/0"))
+	require.NoError(t, err)
+	assert.True(t, contained)
+}
+
+// blockingStore block saves until release is closed.
+type blockingStore struct {
+	*registry.MemoryStore
+	saving  chan registry.Key
+	release chan struct{}
+}
+
+func (s *blockingStore) Save(key registry.Key, data []byte) error {
+	s.saving <- key
+	<-s.release
+	return s.MemoryStore.Save(key, data)
+}
+
+func TestRegistrySpillUnlocked(t *testing.T) {
+	template := registry.DoubleHashing(1000, 0.01, nil)
+	filter, err := template()
+	require.NoError(t, err)
+
+	store := &blockingStore{
+		MemoryStore: registry.NewMemoryStore(),
+		saving:      make(chan registry.Key, 10),
+		release:     make(chan struct{}),
+	}
+	r := registry.New(template, filter.ByteSize(), store)
+	require.NoError(t, r.Add(userKey(0), []byte("https://example.com/0")))
+
+	added := make(chan error)
+	go func() {
+		added <- r.Add(userKey(1), []byte("https://example.com/1"))
+	}()
+	assert.Equal(t, userKey(0), <-store.saving)
+
+	// the registry is usable while saving
+	assert.Equal(t, registry.Stats{Misses: 2, Filters: 1, Bytes: filter.ByteSize()}, r.Stats())
+
+	// lookups of the key being saved wait until it is in the store
+	contained := make(chan bool)
+	go func() {
+		c, err := r.Contain(userKey(0), []byte("https://example.com/0"))
+		assert.NoError(t, err)
+		contained <- c
+	}()
+	select {
+	case <-contained:
+		t.Fatal("lookup did not wait for the save")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(store.release)
+	require.NoError(t, <-added)
+	assert.True(t, <-contained, "loaded back from the store")
+	assert.Equal(t, uint64(1), r.Stats().Loads)
+}
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	store := registry.NewDirStore(filepath.Join(dir, "filters"))
+
+	_, err := store.Load(registry.Key{TenantID: "t", UserID: "u"})
+	assert.ErrorIs(t, err, registry.ErrNotFound)
+
+	for _, key := range []registry.Key{
+		{TenantID: "t", UserID: "u"},
+		{TenantID: "..", UserID: "../../escape"},
+		{TenantID: "t", UserID: ""},
+		{TenantID: "t", UserID: ".tmp-1"},
+	} {
+		require.NoError(t, store.Save(key, []byte(key.String())))
+		data, err := store.Load(key)
+		require.NoError(t, err)
+		assert.Equal(t, key.String(), string(data))
+	}
+
+	// everything stay in the store directory
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "filters", entries[0].Name())
+}
+
+func TestRegistrySparse(t *testing.T) {
+	dense, err := registry.DoubleHashing(1000, 0.01, nil)()
+	require.NoError(t, err)
+	maxBytes := 20 * dense.ByteSize()
+
+	r := registry.New(registry.Sparse(1000, 0.01, nil), maxBytes, registry.NewMemoryStore())
+
+	// users visiting a few URLs fit in the memory of a few dense filters
+	users := 100
+	for i := 0; i < 5*users; i++ {
+		require.NoError(t, r.Add(userKey(i%users), []byte(fmt.Sprintf("https://example.com/%d", i))))
+	}
+	stats := r.Stats()
+	assert.Equal(t, users, stats.Filters)
+	assert.Zero(t, stats.Evictions)
+	assert.Greater(t, stats.Bytes, uint64(0), "accounted as they grow")
+
+	// growing filters are evicted once over budget
+	for i := 5 * users; i < 100*users; i++ {
+		require.NoError(t, r.Add(userKey(i%users), []byte(fmt.Sprintf("https://example.com/%d", i))))
+	}
+	stats = r.Stats()
+	assert.Greater(t, stats.Evictions, uint64(0))
+	assert.LessOrEqual(t, stats.Bytes, maxBytes)
+
+	// and small in the store
+	filter, err := registry.Sparse(1000, 0.01, nil)()
+	require.NoError(t, err)
+	filter.Add([]byte("https://example.com/"))
+	data, err := filter.MarshalBinary()
+	require.NoError(t, err)
+	assert.Less(t, len(data), int(dense.ByteSize()/10))
+}
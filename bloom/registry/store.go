@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// check interface implementation
+var (
+	_ Store = &MemoryStore{}
+	_ Store = &DirStore{}
+)
+
+var ErrNotFound = errors.New("filter not found")
+
+// Store keep the filters evicted from a Registry.
+type Store interface {
+	// Save store the encoded filter of key, replacing any previous one.
+	Save(key Key, data []byte) error
+	// Load return the encoded filter of key or ErrNotFound.
+	Load(key Key) ([]byte, error)
+}
+
+// MemoryStore is an in memory Store, a stand-in for a key-value store like Redis.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[Key][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[Key][]byte)}
+}
+
+func (s *MemoryStore) Save(key Key, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = data
+	return nil
+}
+
+func (s *MemoryStore) Load(key Key) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// DirStore save each filter in a file of a directory tree: dir/tenant/user.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+// path return the file of key.
+func (s *DirStore) path(key Key) string {
+	return filepath.Join(s.dir, escape(key.TenantID), escape(key.UserID)+".bloom")
+}
+
+// escape make id a safe file name: no separator, no leading dot (".." or hidden files) and never empty.
+func escape(id string) string {
+	name := url.PathEscape(id)
+	if name == "" {
+		return "%" // never produced by PathEscape
+	}
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return name
+}
+
+// Save write data in a temporary file renamed over the previous one so a crash never leave a partial filter.
+func (s *DirStore) Save(key Key, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DirStore) Load(key Key) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
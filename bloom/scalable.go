@@ -0,0 +1,324 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync"
+)
+
+// check interface implementation
+var (
+	_ Filter                     = &scalableFilter{}
+	_ encoding.BinaryMarshaler   = &scalableFilter{}
+	_ encoding.BinaryUnmarshaler = &scalableFilter{}
+	_ io.WriterTo                = &scalableFilter{}
+	_ io.ReaderFrom              = &scalableFilter{}
+)
+
+const (
+	// scalableGrowth is the capacity multiplicator between two sub filters.
+	scalableGrowth = 2
+	// scalableRatio is the false positive rate multiplicator between two sub filters.
+	scalableRatio = 0.8
+	// scalableMaxFilters is the maximum number of sub filters, the last one keep growing past its capacity.
+	scalableMaxFilters = 32
+	// scalableHeaderSize is the size of magic, version, hashID, n, fpRate, number of filters and crc32.
+	scalableHeaderSize = 4 + 1 + 8 + 8 + 8 + 4 + checksumSize
+)
+
+var scalableMagic = [4]byte{'B', 'L', 'M', 'S'}
+
+// scalableFilter chain double hashing filters of growing capacity and tightening false positive rate
+// so the overall false positive rate stay under fpRate whatever the number of objects (Almeida et al.).
+// Object are hashed once, the fingerprint is shared by all sub filters.
+type scalableFilter struct {
+	mu      sync.RWMutex
+	hash    hash.Hash
+	hashID  uint64
+	filters []*filter
+	// spec is the hash spec of a hash built by hashspec, embedded when serialized to rebuild the hash.
+	spec string
+	// n is the capacity of the first sub filter.
+	n uint64
+	// fpRate is the overall false positive rate bound.
+	fpRate float64
+}
+
+// NewScalable create a filter starting with a capacity of n objects that grows to keep
+// the false positive rate under fpRate. Without hash a 128 bits murmur3 is used.
+func NewScalable(n uint64, fpRate float64, hashList ...hash.Hash) (*scalableFilter, error) {
+	hash, err := GroupHash(hashList...)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &scalableFilter{
+		hash:   hash,
+		hashID: HashID(hash),
+		spec:   specOf(hash),
+		n:      n,
+		fpRate: fpRate,
+	}
+	if _, err := f.grow(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// grow append a new sub filter.
+func (f *scalableFilter) grow() (*filter, error) {
+	i := len(f.filters)
+	n := f.capacity(i)
+	fpRate := f.fpRate * (1 - scalableRatio) * math.Pow(scalableRatio, float64(i))
+
+	hash, m, k, err := estimate(strategyDoubleHashing, n, fpRate, f.hash)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := newFilter(hash, strategyDoubleHashing, m, k)
+	f.filters = append(f.filters, sub)
+
+	return sub, nil
+}
+
+// newScalableFromBinary create a filter encoded by scalableFilter.MarshalBinary from its hash spec.
+func newScalableFromBinary(data []byte) (*scalableFilter, error) {
+	if len(data) < scalableHeaderSize {
+		return nil, ErrInvalidFormat
+	}
+	hash, err := specHash(data, scalableHeaderSize-checksumSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// sub filters are created by UnmarshalBinary
+	f := &scalableFilter{
+		hash:   hash,
+		hashID: HashID(hash),
+		spec:   hash.Spec(),
+	}
+	if err := f.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// capacity return the number of objects the i-th sub filter is sized for.
+func (f *scalableFilter) capacity(i int) uint64 {
+	return f.n * uint64(math.Pow(scalableGrowth, float64(i)))
+}
+
+func (f *scalableFilter) hashBytes(b []byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hash.Write(b)
+	fp := f.hash.Sum(nil)
+	f.hash.Reset()
+
+	return fp
+}
+
+func (f *scalableFilter) Add(b []byte) {
+	f.AddFingerprint(f.hashBytes(b))
+}
+
+// AddFingerprint add fingerprint to the last sub filter, a new one is created once it is full.
+// Fingerprint already contained are skipped to not waste capacity.
+func (f *scalableFilter) AddFingerprint(fp []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.contain(fp) {
+		return
+	}
+
+	i := len(f.filters) - 1
+	last := f.filters[i]
+	if last.count >= f.capacity(i) && i+1 < scalableMaxFilters {
+		if sub, err := f.grow(); err == nil {
+			last = sub
+		}
+	}
+
+	last.AddFingerprint(fp)
+}
+
+func (f *scalableFilter) Contain(b []byte) bool {
+	return f.ContainFingerprint(f.hashBytes(b))
+}
+
+func (f *scalableFilter) ContainFingerprint(fp []byte) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.contain(fp)
+}
+
+func (f *scalableFilter) contain(fp []byte) bool {
+	// most recent filters hold most objects
+	for i := len(f.filters) - 1; i >= 0; i-- {
+		if f.filters[i].ContainFingerprint(fp) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ByteSize return the memory used by all sub filters bits.
+func (f *scalableFilter) ByteSize() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var size uint64
+	for _, sub := range f.filters {
+		size += sub.ByteSize()
+	}
+
+	return size
+}
+
+// MarshalBinary encode the filter with its configuration, see WriteTo for the layout.
+func (f *scalableFilter) MarshalBinary() ([]byte, error) {
+	f.mu.RLock()
+	size := scalableHeaderSize + 2 + len(f.spec)
+	for _, sub := range f.filters {
+		size += headerSize + 2 + len(sub.spec) + len(sub.fingerprint) + checksumSize
+	}
+	f.mu.RUnlock()
+
+	return marshalBinary(f, size)
+}
+
+// UnmarshalBinary load a filter encoded by MarshalBinary.
+// The filter should have been created with the same hash configuration.
+func (f *scalableFilter) UnmarshalBinary(data []byte) error {
+	return unmarshalBinary(f, data)
+}
+
+// WriteTo stream the filter with its configuration to w.
+//
+// Layout (big endian), each sub filter use the filter layout:
+//
+//	magic "BLMS" | version uint8 | hashID uint64 | n uint64 | fpRate float64 | filters uint32 | crc32c | sub filters...
+//
+// Filters created with a hashspec.Hash are version 2 and embed their hash spec before the header checksum:
+//
+//	... | filters uint32 | spec length uint16 | spec | crc32c | sub filters...
+func (f *scalableFilter) WriteTo(w io.Writer) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	header := make([]byte, scalableHeaderSize-checksumSize, scalableHeaderSize+2+len(f.spec))
+	copy(header, scalableMagic[:])
+	header[4] = formatVersion
+	binary.BigEndian.PutUint64(header[5:], f.hashID)
+	binary.BigEndian.PutUint64(header[13:], f.n)
+	binary.BigEndian.PutUint64(header[21:], math.Float64bits(f.fpRate))
+	binary.BigEndian.PutUint32(header[29:], uint32(len(f.filters)))
+	if f.spec != "" {
+		header[4] = formatVersionSpec
+		var err error
+		if header, err = appendSpec(header, f.spec); err != nil {
+			return 0, err
+		}
+	}
+	header = binary.BigEndian.AppendUint32(header, crc32.Checksum(header, crcTable))
+
+	n, err := w.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	for _, sub := range f.filters {
+		n, err := sub.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// ReadFrom load a filter streamed by WriteTo from r.
+// The filter should have been created with the same hash configuration.
+func (f *scalableFilter) ReadFrom(r io.Reader) (int64, error) {
+	crc := crc32.New(crcTable)
+	cr := &countReader{r: io.TeeReader(r, crc)}
+
+	var header [scalableHeaderSize - checksumSize]byte
+	if _, err := io.ReadFull(cr, header[:]); err != nil {
+		return cr.n, readError(err)
+	}
+	if !bytes.Equal(header[:4], scalableMagic[:]) {
+		return cr.n, ErrInvalidFormat
+	}
+	if header[4] != formatVersion && header[4] != formatVersionSpec {
+		return cr.n, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header[4])
+	}
+	// the spec only describe the hash, already identified by hashID
+	if header[4] == formatVersionSpec {
+		if _, err := readSpec(cr); err != nil {
+			return cr.n, err
+		}
+	}
+	expected := crc.Sum32()
+
+	var sum [checksumSize]byte
+	if _, err := io.ReadFull(cr, sum[:]); err != nil {
+		return cr.n, readError(err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != expected {
+		return cr.n, ErrChecksum
+	}
+	read := cr.n
+
+	id := binary.BigEndian.Uint64(header[5:])
+	capacity := binary.BigEndian.Uint64(header[13:])
+	fpRate := math.Float64frombits(binary.BigEndian.Uint64(header[21:]))
+	count := binary.BigEndian.Uint32(header[29:])
+
+	// hash and hashID never change after creation
+	if id != f.hashID {
+		return read, ErrHashMismatch
+	}
+	if capacity == 0 || !(fpRate > 0 && fpRate < 1) || count == 0 || count > scalableMaxFilters {
+		return read, fmt.Errorf("%w: n=%d filters=%d", ErrInvalidFormat, capacity, count)
+	}
+
+	filters := make([]*filter, 0, count)
+	for i := uint32(0); i < count; i++ {
+		sub := &filter{
+			hash:     f.hash,
+			strategy: strategyDoubleHashing,
+			hashID:   f.hashID,
+			spec:     f.spec,
+		}
+		n, err := sub.ReadFrom(r)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		filters = append(filters, sub)
+	}
+
+	f.mu.Lock()
+	f.filters = filters
+	f.n = capacity
+	f.fpRate = fpRate
+	f.mu.Unlock()
+
+	return read, nil
+}
@@ -0,0 +1,113 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScalableFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      uint64
+		fpRate float64
+		added  uint64
+	}{
+		{
+			name:   "under capacity",
+			n:      10000,
+			fpRate: 0.01,
+			added:  5000,
+		},
+		{
+			name:   "10x capacity",
+			n:      1000,
+			fpRate: 0.01,
+			added:  10000,
+		},
+		{
+			name:   "1000x capacity",
+			n:      100,
+			fpRate: 0.05,
+			added:  100000,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := bloom.NewScalable(tt.n, tt.fpRate)
+			require.NoError(t, err)
+
+			for i := uint64(0); i < tt.added; i++ {
+				filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			for i := uint64(0); i < tt.added; i++ {
+				require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+			}
+
+			falsePositive := 0
+			for i := tt.added; i < 2*tt.added; i++ {
+				if filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))) {
+					falsePositive++
+				}
+			}
+			assert.Less(t, float64(falsePositive)/float64(tt.added), tt.fpRate, "false positive rate")
+
+			data, err := filter.MarshalBinary()
+			require.NoError(t, err)
+
+			filter2, err := bloom.NewScalable(1, 0.5)
+			require.NoError(t, err)
+			require.NoError(t, filter2.UnmarshalBinary(data))
+			assert.Equal(t, filter.ByteSize(), filter2.ByteSize())
+			for i := uint64(0); i < tt.added; i++ {
+				require.True(t, filter2.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative after load")
+			}
+
+			data2, err := filter2.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, data, data2, "round trip")
+		})
+	}
+}
+
+func TestScalableFilterBinary(t *testing.T) {
+	filter, err := bloom.NewScalable(10, 0.01, crypto.SHA256.New())
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	data, err := filter.MarshalBinary()
+	require.NoError(t, err)
+
+	t.Run("HashMismatch", func(t *testing.T) {
+		filter2, err := bloom.NewScalable(10, 0.01)
+		require.NoError(t, err)
+		assert.ErrorIs(t, filter2.UnmarshalBinary(data), bloom.ErrHashMismatch)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		filter2, err := bloom.NewScalable(10, 0.01, crypto.SHA256.New())
+		require.NoError(t, err)
+		assert.ErrorIs(t, filter2.UnmarshalBinary(data[:len(data)-1]), bloom.ErrInvalidFormat)
+		assert.False(t, filter2.Contain([]byte("https://example.com/0")), "partially loaded")
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		filter2, err := bloom.NewScalable(10, 0.01, crypto.SHA256.New())
+		require.NoError(t, err)
+		corrupted := append([]byte(nil), data...)
+		corrupted[15] ^= 0xff
+		assert.ErrorIs(t, filter2.UnmarshalBinary(corrupted), bloom.ErrChecksum)
+	})
+
+	t.Run("PlainFilter", func(t *testing.T) {
+		plain, err := bloom.NewDoubleHashing(10, 0.01, crypto.SHA256.New())
+		require.NoError(t, err)
+		assert.ErrorIs(t, plain.UnmarshalBinary(data), bloom.ErrInvalidFormat)
+	})
+}
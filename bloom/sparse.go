@@ -0,0 +1,463 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sync"
+)
+
+// check interface implementation
+var (
+	_ Filter                     = &sparseFilter{}
+	_ encoding.BinaryMarshaler   = &sparseFilter{}
+	_ encoding.BinaryUnmarshaler = &sparseFilter{}
+)
+
+const (
+	// maxSparseFillRatio is the fill ratio past which a sparse filter switch to dense bits,
+	// at 16 bits by set bit the positions then use half the memory of the dense bits.
+	maxSparseFillRatio = 1.0 / 32
+	// containerBits is the number of positions covered by a container.
+	containerBits = 1 << 16
+	// containerOverhead is the memory used by a container besides its positions.
+	containerOverhead = 32
+)
+
+// sparseMagic differ from the dense magic and scalableMagic so formats are detected from their header.
+var sparseMagic = [4]byte{'B', 'L', 'M', 'P'}
+
+// container hold the low 16 bits of the set positions sharing the same high bits, sorted.
+type container struct {
+	key uint64
+	low []uint16
+}
+
+// sparseFilter is a double hashing filter storing the positions of its set bits while few are set, roaring style:
+// positions are grouped in containers by their high bits and only their low 16 bits are kept, about 2 bytes
+// by set bit instead of m/8 bytes for the whole array. Past maxSparseFillRatio positions are moved to dense bits
+// and the filter behave like the one created by NewDoubleHashing, answers never change on the switch.
+type sparseFilter struct {
+	mu sync.RWMutex
+	// filter hold the hash and layout, its bits are only allocated once dense.
+	filter *filter
+	dense  bool
+	// containers are sorted by key, set is the number of positions they hold.
+	containers []container
+	set        uint64
+	// count is the number of objects added while sparse.
+	count uint64
+	// maxSet is the number of set bits past which the filter become dense.
+	maxSet uint64
+}
+
+// NewSparse create a filter sized like NewDoubleHashing using little memory while few objects are added,
+// like the filter of a user who visited a few URLs. Without hash a 128 bits murmur3 is used.
+func NewSparse(n uint64, fpRate float64, hashList ...hash.Hash) (*sparseFilter, error) {
+	hash, m, k, err := estimate(strategyDoubleHashing, n, fpRate, hashList...)
+	if err != nil {
+		return nil, err
+	}
+	f := newSparse(hash, m, k)
+	f.filter.murmur = len(hashList) == 0
+
+	return f, nil
+}
+
+// newSparse create an empty sparse filter of m bits and k positions by object.
+func newSparse(hash hash.Hash, m, k uint64) *sparseFilter {
+	return &sparseFilter{
+		filter: newFilterWithBits(hash, strategyDoubleHashing, m, k, nil),
+		maxSet: uint64(float64(m) * maxSparseFillRatio),
+	}
+}
+
+// newSparseFromBinary create a filter encoded by sparseFilter.MarshalBinary from its hash spec.
+func newSparseFromBinary(data []byte) (*sparseFilter, error) {
+	if len(data) < headerSize {
+		return nil, ErrInvalidFormat
+	}
+	hash, err := specHash(data, headerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	m := binary.BigEndian.Uint64(data[14:])
+	k := binary.BigEndian.Uint64(data[22:])
+	f := newSparse(hash, m, k)
+	if err := f.filter.validate(m, k); err != nil {
+		return nil, err
+	}
+	if err := f.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// find return the index of the container of key, or where to insert it.
+func (f *sparseFilter) find(key uint64) (int, bool) {
+	lo, hi := 0, len(f.containers)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if f.containers[mid].key < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(f.containers) && f.containers[lo].key == key
+}
+
+// search return the index of v in the sorted low, or where to insert it.
+func search(low []uint16, v uint16) (int, bool) {
+	lo, hi := 0, len(low)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if low[mid] < v {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(low) && low[lo] == v
+}
+
+// setPosition add pos to the containers, return false if it was already set.
+func (f *sparseFilter) setPosition(pos uint64) bool {
+	key, v := pos/containerBits, uint16(pos%containerBits)
+
+	i, ok := f.find(key)
+	if !ok {
+		f.containers = append(f.containers, container{})
+		copy(f.containers[i+1:], f.containers[i:])
+		f.containers[i] = container{key: key}
+	}
+	c := &f.containers[i]
+
+	j, ok := search(c.low, v)
+	if ok {
+		return false
+	}
+	c.low = append(c.low, 0)
+	copy(c.low[j+1:], c.low[j:])
+	c.low[j] = v
+
+	return true
+}
+
+// testPosition return if pos is in the containers.
+func (f *sparseFilter) testPosition(pos uint64) bool {
+	i, ok := f.find(pos / containerBits)
+	if !ok {
+		return false
+	}
+	_, ok = search(f.containers[i].low, uint16(pos%containerBits))
+	return ok
+}
+
+// densify move the positions to dense bits, f.mu should be held for writing.
+func (f *sparseFilter) densify() {
+	bits := make([]byte, f.filter.strategy.size(f.filter.m))
+	for _, c := range f.containers {
+		for _, v := range c.low {
+			pos := c.key*containerBits + uint64(v)
+			bits[pos/8] |= 1 << (pos % 8)
+		}
+	}
+
+	f.filter.mu.Lock()
+	f.filter.fingerprint = bits
+	f.filter.count = f.count
+	f.filter.mu.Unlock()
+
+	f.containers = nil
+	f.set = 0
+	f.count = 0
+	f.dense = true
+}
+
+// Dense return if the filter switched to dense bits.
+func (f *sparseFilter) Dense() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.dense
+}
+
+func (f *sparseFilter) Add(b []byte) {
+	if f.filter.murmur { // called directly so fp stay on the stack
+		fp := BytesHasher{}.Fingerprint(b)
+		f.AddFingerprint(fp[:])
+		return
+	}
+
+	f.filter.withFingerprint(b, f.AddFingerprint)
+}
+
+func (f *sparseFilter) AddFingerprint(fp []byte) {
+	f.mu.RLock()
+	if f.dense {
+		f.filter.AddFingerprint(fp)
+		f.mu.RUnlock()
+		return
+	}
+	f.mu.RUnlock()
+
+	// m and k never change after creation
+	var buf [maxStackPositions]uint64
+	positions := f.filter.strategy.positions(buf[:0], fp, f.filter.m, f.filter.k)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.dense { // switched meanwhile
+		f.filter.AddFingerprint(fp)
+		return
+	}
+
+	f.count++
+	for _, pos := range positions {
+		if f.setPosition(pos) {
+			f.set++
+		}
+	}
+	if f.set > f.maxSet {
+		f.densify()
+	}
+}
+
+func (f *sparseFilter) Contain(b []byte) bool {
+	if f.filter.murmur {
+		fp := BytesHasher{}.Fingerprint(b)
+		return f.ContainFingerprint(fp[:])
+	}
+
+	var contained bool
+	f.filter.withFingerprint(b, func(fp []byte) {
+		contained = f.ContainFingerprint(fp)
+	})
+	return contained
+}
+
+func (f *sparseFilter) ContainFingerprint(fp []byte) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.dense {
+		return f.filter.ContainFingerprint(fp)
+	}
+
+	var buf [maxStackPositions]uint64
+	for _, pos := range f.filter.strategy.positions(buf[:0], fp, f.filter.m, f.filter.k) {
+		if !f.testPosition(pos) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ByteSize return the memory used by the positions while sparse and by the bits once dense.
+func (f *sparseFilter) ByteSize() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.dense {
+		return f.filter.ByteSize()
+	}
+
+	size := uint64(len(f.containers)) * containerOverhead
+	for _, c := range f.containers {
+		size += 2 * uint64(cap(c.low))
+	}
+
+	return size
+}
+
+// Stats return the occupancy of the filter.
+func (f *sparseFilter) Stats() Stats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.dense {
+		return f.filter.Stats()
+	}
+
+	return f.filter.statsOf(f.set, f.count)
+}
+
+// MarshalBinary encode a dense filter like filter.MarshalBinary and a sparse one as the gaps between its positions.
+//
+// Sparse layout (big endian):
+//
+//	magic "BLMP" | version uint8 | strategy uint8 | hashID uint64 | m uint64 | k uint64 | count uint64 | set uvarint | gaps uvarint | crc32c
+//
+// Like dense filters, sparse filters created with a hashspec.Hash are version 2 and embed their hash spec after the header:
+//
+//	... | count uint64 | spec length uint16 | spec | set uvarint | ...
+func (f *sparseFilter) MarshalBinary() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.dense {
+		return f.filter.MarshalBinary()
+	}
+
+	// while sparse most gaps are under 16384 and take at most 2 bytes
+	spec := f.filter.spec
+	data := make([]byte, headerSize, headerSize+2+len(spec)+binary.MaxVarintLen64+2*int(f.set)+checksumSize)
+	f.filter.putHeader(data, sparseMagic)
+	binary.BigEndian.PutUint64(data[30:], f.count)
+	if spec != "" {
+		data[4] = formatVersionSpec
+		var err error
+		if data, err = appendSpec(data, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	data = binary.AppendUvarint(data, f.set)
+	var prev uint64
+	for _, c := range f.containers {
+		for _, v := range c.low {
+			pos := c.key*containerBits + uint64(v)
+			data = binary.AppendUvarint(data, pos-prev)
+			prev = pos
+		}
+	}
+
+	return binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crcTable)), nil
+}
+
+// UnmarshalBinary load a filter encoded by MarshalBinary, sparse or dense.
+// The filter should have been created with the same hash configuration and size.
+func (f *sparseFilter) UnmarshalBinary(data []byte) error {
+	if len(data) >= 4 && bytes.Equal(data[:4], magic[:]) {
+		return f.unmarshalDense(data)
+	}
+
+	containers, set, count, err := f.decodeSparse(data)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.filter.mu.Lock()
+	f.filter.fingerprint = nil
+	f.filter.count = 0
+	f.filter.mu.Unlock()
+
+	f.containers = containers
+	f.set = set
+	f.count = count
+	f.dense = false
+	if f.set > f.maxSet {
+		f.densify()
+	}
+
+	return nil
+}
+
+// unmarshalDense load dense bits encoded by filter.MarshalBinary.
+func (f *sparseFilter) unmarshalDense(data []byte) error {
+	// hash is only used for its size, never written
+	loaded := &filter{hash: f.filter.hash, strategy: f.filter.strategy, hashID: f.filter.hashID}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	if err := f.checkSize(loaded.m, loaded.k); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.filter.mu.Lock()
+	f.filter.fingerprint = loaded.fingerprint
+	f.filter.count = loaded.count
+	f.filter.mu.Unlock()
+
+	f.containers = nil
+	f.set = 0
+	f.count = 0
+	f.dense = true
+
+	return nil
+}
+
+// checkSize refuse m and k different from the filter ones.
+func (f *sparseFilter) checkSize(m, k uint64) error {
+	if m != f.filter.m || k != f.filter.k {
+		return fmt.Errorf("%w: m=%d k=%d, filter has m=%d k=%d", ErrInvalidFormat, m, k, f.filter.m, f.filter.k)
+	}
+	return nil
+}
+
+// decodeSparse return the containers, number of positions and count of a sparse filter encoded by MarshalBinary.
+func (f *sparseFilter) decodeSparse(data []byte) ([]container, uint64, uint64, error) {
+	if len(data) < headerSize+checksumSize {
+		return nil, 0, 0, fmt.Errorf("%w: %d bytes", ErrInvalidFormat, len(data))
+	}
+	if !bytes.Equal(data[:4], sparseMagic[:]) {
+		return nil, 0, 0, ErrInvalidFormat
+	}
+	if data[4] != formatVersion && data[4] != formatVersionSpec {
+		return nil, 0, 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[4])
+	}
+	if strategy(data[5]) != f.filter.strategy || binary.BigEndian.Uint64(data[6:]) != f.filter.hashID {
+		return nil, 0, 0, ErrHashMismatch
+	}
+	if err := f.checkSize(binary.BigEndian.Uint64(data[14:]), binary.BigEndian.Uint64(data[22:])); err != nil {
+		return nil, 0, 0, err
+	}
+	count := binary.BigEndian.Uint64(data[30:])
+
+	body := data[:len(data)-checksumSize]
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(data[len(body):]) {
+		return nil, 0, 0, ErrChecksum
+	}
+
+	r := body[headerSize:]
+	// the spec only describe the hash, already identified by hashID
+	if data[4] == formatVersionSpec {
+		if len(r) < 2 || len(r) < 2+int(binary.BigEndian.Uint16(r)) {
+			return nil, 0, 0, fmt.Errorf("%w: truncated hash spec", ErrInvalidFormat)
+		}
+		r = r[2+int(binary.BigEndian.Uint16(r)):]
+	}
+	set, n := binary.Uvarint(r)
+	if n <= 0 || set > f.filter.m {
+		return nil, 0, 0, fmt.Errorf("%w: invalid number of positions", ErrInvalidFormat)
+	}
+	r = r[n:]
+
+	var containers []container
+	var pos uint64
+	for i := uint64(0); i < set; i++ {
+		gap, n := binary.Uvarint(r)
+		// positions are strictly increasing and lower than m
+		if n <= 0 || (i > 0 && gap == 0) || gap >= f.filter.m-pos {
+			return nil, 0, 0, fmt.Errorf("%w: invalid position gap", ErrInvalidFormat)
+		}
+		r = r[n:]
+		pos += gap
+
+		key := pos / containerBits
+		if len(containers) == 0 || containers[len(containers)-1].key != key {
+			containers = append(containers, container{key: key})
+		}
+		c := &containers[len(containers)-1]
+		c.low = append(c.low, uint16(pos%containerBits))
+	}
+	if len(r) != 0 {
+		return nil, 0, 0, fmt.Errorf("%w: %d trailing bytes", ErrInvalidFormat, len(r))
+	}
+
+	return containers, set, count, nil
+}
@@ -0,0 +1,165 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"fmt"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparseFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		hashList func() []hash.Hash
+	}{
+		{
+			name:     "Murmur3_128",
+			hashList: func() []hash.Hash { return nil },
+		},
+		{
+			name:     "SHA256",
+			hashList: func() []hash.Hash { return []hash.Hash{crypto.SHA256.New()} },
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := uint64(1000)
+			sparse, err := bloom.NewSparse(n, 0.01, tt.hashList()...)
+			require.NoError(t, err)
+			dense, err := bloom.NewDoubleHashing(n, 0.01, tt.hashList()...)
+			require.NoError(t, err)
+			denseSize := dense.ByteSize()
+
+			// a user visiting a few URLs
+			for i := 0; i < 5; i++ {
+				sparse.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+				dense.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			assert.False(t, sparse.Dense())
+			assert.Less(t, sparse.ByteSize(), denseSize/5)
+			assert.Equal(t, dense.Stats(), sparse.Stats())
+
+			// answers never change on the switch
+			i := 5
+			for ; !sparse.Dense(); i++ {
+				require.Less(t, i, int(n), "never switched to dense")
+				for j := 0; j < 1000; j++ {
+					object := []byte(fmt.Sprintf("https://example.org/%d", j))
+					require.Equal(t, dense.Contain(object), sparse.Contain(object))
+				}
+				sparse.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+				dense.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			t.Logf("dense after %d objects", i)
+			assert.Less(t, sparse.Stats().FillRatio, 0.05)
+			assert.Equal(t, denseSize, sparse.ByteSize())
+
+			for ; i < int(n); i++ {
+				sparse.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+				dense.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			for j := 0; j < int(n); j++ {
+				require.True(t, sparse.Contain([]byte(fmt.Sprintf("https://example.com/%d", j))), "false negative")
+			}
+
+			// same bits and count
+			sparseData, err := sparse.MarshalBinary()
+			require.NoError(t, err)
+			denseData, err := dense.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, denseData, sparseData)
+		})
+	}
+}
+
+func TestSparseFilterMarshal(t *testing.T) {
+	n := uint64(100000)
+	filter, err := bloom.NewSparse(n, 0.01)
+	require.NoError(t, err)
+	dense, err := bloom.NewDoubleHashing(n, 0.01)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	data, err := filter.MarshalBinary()
+	require.NoError(t, err)
+	assert.Less(t, len(data), int(dense.ByteSize()/100), "compressed")
+
+	loaded, err := bloom.NewSparse(n, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	assert.False(t, loaded.Dense())
+	assert.Equal(t, filter.Stats(), loaded.Stats())
+	for i := 0; i < 20; i++ {
+		require.True(t, loaded.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+	}
+
+	// dense encoding is loaded as dense bits
+	dense.Add([]byte("https://example.com/dense"))
+	denseData, err := dense.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, loaded.UnmarshalBinary(denseData))
+	assert.True(t, loaded.Dense())
+	assert.True(t, loaded.Contain([]byte("https://example.com/dense")))
+	assert.False(t, loaded.Contain([]byte("https://example.com/0")))
+
+	// and back to sparse
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	assert.False(t, loaded.Dense())
+	assert.True(t, loaded.Contain([]byte("https://example.com/0")))
+
+	other, err := bloom.NewSparse(n, 0.01, crypto.SHA256.New())
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.UnmarshalBinary(data), bloom.ErrHashMismatch)
+
+	smaller, err := bloom.NewSparse(n/2, 0.01)
+	require.NoError(t, err)
+	assert.ErrorIs(t, smaller.UnmarshalBinary(data), bloom.ErrInvalidFormat)
+	assert.ErrorIs(t, smaller.UnmarshalBinary(denseData), bloom.ErrInvalidFormat)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-10] ^= 0xff
+	assert.ErrorIs(t, loaded.UnmarshalBinary(corrupted), bloom.ErrChecksum)
+	assert.ErrorIs(t, loaded.UnmarshalBinary(data[:len(data)-5]), bloom.ErrChecksum)
+	assert.ErrorIs(t, loaded.UnmarshalBinary(data[:20]), bloom.ErrInvalidFormat)
+}
+
+func TestSparseFilterScalableFormat(t *testing.T) {
+	sparse, err := bloom.NewSparse(1000, 0.01)
+	require.NoError(t, err)
+	sparse.Add([]byte("https://example.com/"))
+	sparseData, err := sparse.MarshalBinary()
+	require.NoError(t, err)
+
+	scalable, err := bloom.NewScalable(1000, 0.01)
+	require.NoError(t, err)
+	scalable.Add([]byte("https://example.com/"))
+	scalableData, err := scalable.MarshalBinary()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, sparse.UnmarshalBinary(scalableData), bloom.ErrInvalidFormat)
+	assert.ErrorIs(t, scalable.UnmarshalBinary(sparseData), bloom.ErrInvalidFormat)
+	assert.True(t, sparse.Contain([]byte("https://example.com/")))
+	assert.True(t, scalable.Contain([]byte("https://example.com/")))
+}
+
+func BenchmarkSparseFilter(b *testing.B) {
+	filter, err := bloom.NewSparse(1000000, 0.01)
+	require.NoError(b, err)
+	for i := 0; i < 1000; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	object := []byte("https://example.com/42")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.Contain(object)
+	}
+}
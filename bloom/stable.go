@@ -0,0 +1,161 @@
+package bloom
+
+import (
+	"fmt"
+	"hash"
+	"math"
+	"sync"
+)
+
+// check interface implementation
+var _ Filter = &stableFilter{}
+
+// stableMax is the value set in the 2 bits cells of an added object.
+const stableMax = 3
+
+// stableFilter is a stable bloom filter (Deng & Rafiei): each insert decrement p random cells before
+// setting the k cells of the object to stableMax, so old objects fade away and the false positive rate
+// converge to a fixed value whatever the length of the stream.
+// In return objects can be forgotten: a cell survive about stableMax*m/p inserts.
+type stableFilter struct {
+	mu       sync.RWMutex
+	hash     hash.Hash
+	cells    []byte // four 2 bits cells by byte, position 0 use the lowest bits
+	strategy strategy
+	m        uint64
+	k        uint64
+	// p is the number of cells decremented by insert, its fractional part is the probability of one more.
+	p     float64
+	count uint64
+	// rand state used to pick cells to decrement.
+	rand uint64
+}
+
+// NewStable create a stable filter of m cells whose false positive rate converge to fpRate.
+// It use m/4 bytes, the more cells the longer objects are remembered. Without hash a 128 bits murmur3 is used.
+func NewStable(m uint64, fpRate float64, hashList ...hash.Hash) (*stableFilter, error) {
+	if m == 0 || !(fpRate > 0 && fpRate < 1) {
+		return nil, fmt.Errorf("%w: m=%d fpRate=%f", ErrInvalidEstimates, m, fpRate)
+	}
+
+	// same number of positions as a bloom filter half full at fpRate
+	k := uint64(math.Round(-math.Log2(fpRate)))
+	if k < 1 {
+		k = 1
+	}
+	if k > maxStackPositions || k >= m {
+		return nil, fmt.Errorf("%w: fpRate=%f need %d positions in %d cells", ErrInvalidEstimates, fpRate, k, m)
+	}
+
+	hash, err := GroupHash(hashList...)
+	if err != nil {
+		return nil, err
+	}
+	if hash.Size() < 16 {
+		return nil, fmt.Errorf("%w: double hashing need 16 bytes, hash only produce %d", ErrHashTooShort, hash.Size())
+	}
+
+	// at the stable point a cell is 0 with probability (1/(1+1/(p*(1/k-1/m))))^stableMax
+	// and the false positive rate is (1-zero)^k, solved for p.
+	zero := 1 - math.Pow(fpRate, 1/float64(k))
+	p := 1 / ((math.Pow(zero, -1/float64(stableMax)) - 1) * (1/float64(k) - 1/float64(m)))
+	if p > float64(m) {
+		p = float64(m)
+	}
+
+	return &stableFilter{
+		hash:     hash,
+		cells:    make([]byte, (m+3)/4),
+		strategy: strategyDoubleHashing,
+		m:        m,
+		k:        k,
+		p:        p,
+		rand:     0x9e3779b97f4a7c15,
+	}, nil
+}
+
+func (f *stableFilter) hashBytes(b []byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.hash.Write(b)
+	fp := f.hash.Sum(nil)
+	f.hash.Reset()
+
+	return fp
+}
+
+func (f *stableFilter) Add(b []byte) {
+	f.AddFingerprint(f.hashBytes(b))
+}
+
+func (f *stableFilter) AddFingerprint(fp []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.count++
+	f.decay()
+
+	var buf [maxStackPositions]uint64
+	for _, pos := range f.strategy.positions(buf[:0], fp, f.m, f.k) {
+		f.setCell(pos, stableMax)
+	}
+}
+
+// decay decrement p consecutive cells from a random position.
+func (f *stableFilter) decay() {
+	p := uint64(f.p)
+	if frac := f.p - float64(p); frac > 0 && float64(f.next()>>11)/(1<<53) < frac {
+		p++
+	}
+
+	pos := f.next() % f.m
+	for i := uint64(0); i < p; i++ {
+		if c := f.cell(pos); c > 0 {
+			f.setCell(pos, c-1)
+		}
+		if pos++; pos == f.m {
+			pos = 0
+		}
+	}
+}
+
+func (f *stableFilter) Contain(b []byte) bool {
+	return f.ContainFingerprint(f.hashBytes(b))
+}
+
+func (f *stableFilter) ContainFingerprint(fp []byte) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var buf [maxStackPositions]uint64
+	for _, pos := range f.strategy.positions(buf[:0], fp, f.m, f.k) {
+		if f.cell(pos) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ByteSize return the memory used by the cells.
+func (f *stableFilter) ByteSize() uint64 {
+	return uint64(len(f.cells))
+}
+
+func (f *stableFilter) cell(pos uint64) byte {
+	return f.cells[pos/4] >> (2 * (pos % 4)) & stableMax
+}
+
+func (f *stableFilter) setCell(pos uint64, c byte) {
+	shift := 2 * (pos % 4)
+	f.cells[pos/4] = f.cells[pos/4]&^(stableMax<<shift) | c<<shift
+}
+
+// next return a pseudo random number (xorshift64).
+func (f *stableFilter) next() uint64 {
+	f.rand ^= f.rand << 13
+	f.rand ^= f.rand >> 7
+	f.rand ^= f.rand << 17
+	return f.rand
+}
@@ -0,0 +1,111 @@
+package bloom_test
+
+import (
+	"bloom"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// producerStream replay the message ids sent by producer workers: 5% of events
+// (taskNbr%20 == 5) resend the last event stored on taskNbr%3 == 0.
+func producerStream(n int, yield func(id []byte, duplicate bool)) {
+	var dup []byte
+	for taskNbr := 0; taskNbr < n; taskNbr++ {
+		id, duplicate := []byte(fmt.Sprintf("message-%d", taskNbr)), false
+		if taskNbr%20 == 5 && dup != nil {
+			id, duplicate = dup, true
+		}
+		if taskNbr%3 == 0 {
+			dup = id
+		}
+		yield(id, duplicate)
+	}
+}
+
+func TestStableFilterProducerDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      uint64
+		fpRate float64
+		events int
+	}{
+		{
+			name:   "1%",
+			m:      100000,
+			fpRate: 0.01,
+			events: 1000000,
+		},
+		{
+			name:   "0.1%",
+			m:      200000,
+			fpRate: 0.001,
+			events: 1000000,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := bloom.NewStable(tt.m, tt.fpRate)
+			require.NoError(t, err)
+
+			var duplicates, missed, unique, falsePositive int
+			producerStream(tt.events, func(id []byte, duplicate bool) {
+				seen := filter.Contain(id)
+				filter.Add(id)
+
+				if duplicate {
+					duplicates++
+					if !seen {
+						missed++
+					}
+					return
+				}
+				unique++
+				if seen {
+					falsePositive++
+				}
+			})
+
+			assert.InDelta(t, 0.05, float64(duplicates)/float64(tt.events), 0.001, "duplicate rate")
+			// duplicates are sent within a few events, they should all be caught
+			assert.Zero(t, missed, "missed duplicates")
+			// the stream is many times the capacity of a bloom filter of the same size, the rate stay bounded
+			assert.Less(t, float64(falsePositive)/float64(unique), tt.fpRate*1.2, "false positive rate")
+		})
+	}
+}
+
+func TestStableFilterSteadyState(t *testing.T) {
+	fpRate := 0.01
+	filter, err := bloom.NewStable(50000, fpRate)
+	require.NoError(t, err)
+
+	// false positive rate on fresh objects measured after each batch
+	probe := 0
+	for batch := 0; batch < 10; batch++ {
+		for i := 0; i < 50000; i++ {
+			filter.Add([]byte(fmt.Sprintf("https://example.com/%d/%d", batch, i)))
+		}
+
+		falsePositive := 0
+		for i := 0; i < 10000; i++ {
+			if filter.Contain([]byte(fmt.Sprintf("https://example.com/missing/%d", probe))) {
+				falsePositive++
+			}
+			probe++
+		}
+		assert.Less(t, float64(falsePositive)/10000, fpRate*1.3, "false positive rate after %d objects", (batch+1)*50000)
+	}
+}
+
+func TestStableFilterInvalid(t *testing.T) {
+	_, err := bloom.NewStable(0, 0.01)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+	_, err = bloom.NewStable(1000, 1)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+	_, err = bloom.NewStable(4, 0.001)
+	assert.ErrorIs(t, err, bloom.ErrInvalidEstimates)
+}
@@ -0,0 +1,82 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// maxFillRatio is the fill ratio of an optimally sized filter at full capacity,
+// past it the false positive rate exceed the one the filter was sized for.
+const maxFillRatio = 0.5
+
+// Stats describe the occupancy of a filter.
+type Stats struct {
+	// Bits is the number of bits of the filter.
+	Bits uint64
+	// BitsSet is the number of bits set to 1.
+	BitsSet uint64
+	// FillRatio is BitsSet / Bits.
+	FillRatio float64
+	// Count is the number of objects added, including duplicates.
+	Count uint64
+	// EstimatedCount is the number of distinct objects estimated from bits set.
+	EstimatedCount uint64
+	// FalsePositiveRate is the current expected false positive rate.
+	FalsePositiveRate float64
+	// Saturated is true once the filter is filled over its capacity and answers should not be trusted.
+	Saturated bool
+}
+
+// Stats return the occupancy of the filter.
+func (f *filter) Stats() Stats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.statsOf(popCount(f.fingerprint), f.count)
+}
+
+// statsOf return the occupancy of a filter with the layout of f, set bits and count objects.
+func (f *filter) statsOf(set, count uint64) Stats {
+	fill := float64(set) / float64(f.m)
+
+	// with all bits set estimation is infinite, count as if one was still unset
+	unset := float64(f.m - set)
+	if unset == 0 {
+		unset = 1
+	}
+
+	var estimated, fpRate float64
+	if f.strategy == strategyDigest {
+		// each object set about half of the bits
+		estimated = -math.Log2(unset / float64(f.m))
+		fpRate = math.Pow(fill, float64(f.m)/2)
+	} else {
+		// Swamidass & Baldi estimation
+		estimated = -float64(f.m) / float64(f.k) * math.Log(unset/float64(f.m))
+		fpRate = math.Pow(fill, float64(f.k))
+	}
+
+	return Stats{
+		Bits:              f.m,
+		BitsSet:           set,
+		FillRatio:         fill,
+		Count:             count,
+		EstimatedCount:    uint64(math.Round(estimated)),
+		FalsePositiveRate: fpRate,
+		Saturated:         fill > maxFillRatio,
+	}
+}
+
+// popCount return the number of bits set in b.
+func popCount(b []byte) uint64 {
+	var n int
+	for ; len(b) >= 8; b = b[8:] {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(b))
+	}
+	for _, v := range b {
+		n += bits.OnesCount8(v)
+	}
+
+	return uint64(n)
+}
@@ -0,0 +1,61 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilterStats(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(10000, 0.01)
+	require.NoError(t, err)
+
+	stats := filter.Stats()
+	assert.Equal(t, uint64(95851), stats.Bits)
+	assert.Zero(t, stats.BitsSet)
+	assert.Zero(t, stats.EstimatedCount)
+	assert.Zero(t, stats.FalsePositiveRate)
+	assert.False(t, stats.Saturated)
+
+	added, duplicates := uint64(0), uint64(0)
+	for _, n := range []uint64{100, 1000, 5000} {
+		for ; added < n; added++ {
+			filter.Add([]byte(fmt.Sprintf("https://example.com/%d", added)))
+		}
+		// duplicates are counted but not estimated
+		filter.Add([]byte("https://example.com/0"))
+		duplicates++
+
+		stats = filter.Stats()
+		assert.Equal(t, added+duplicates, stats.Count, "count")
+		assert.InEpsilon(t, n, stats.EstimatedCount, 0.05, "estimated count")
+		assert.InDelta(t, float64(stats.BitsSet)/float64(stats.Bits), stats.FillRatio, 1e-9, "fill ratio")
+		assert.InDelta(t, bloom.EstimateFalsePositiveRate(stats.Bits, 7, n), stats.FalsePositiveRate, 0.002, "false positive rate")
+		assert.False(t, stats.Saturated, "saturated")
+	}
+
+	// over capacity
+	for i := added; i < 20000; i++ {
+		filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	stats = filter.Stats()
+	assert.True(t, stats.Saturated, "saturated")
+	assert.Greater(t, stats.FalsePositiveRate, 0.01)
+
+	t.Run("Digest", func(t *testing.T) {
+		filter, err := bloom.New(crypto.SHA512.New())
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			filter.Add([]byte(fmt.Sprintf("https://example.com/%d", i)))
+		}
+
+		stats := filter.Stats()
+		assert.Equal(t, uint64(512), stats.Bits)
+		assert.True(t, stats.Saturated)
+		assert.InDelta(t, 10, stats.EstimatedCount, 3)
+	})
+}
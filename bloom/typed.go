@@ -0,0 +1,233 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/twmb/murmur3"
+)
+
+// check interface implementation
+var (
+	_ Hasher[string] = StringHasher{}
+	_ Hasher[[]byte] = BytesHasher{}
+	_ Hasher[int]    = IntegerHasher[int]{}
+	_ Hasher[any]    = &StructHasher[any]{}
+)
+
+// Hasher compute the 128 bits fingerprint of a T.
+// Built-in hashers use murmur3 like filters created without hash: Typed[string].Add(s) and Add([]byte(s))
+// set the same bits, the fingerprint of an integer is the one of its 8 bytes big endian representation.
+type Hasher[T any] interface {
+	Fingerprint(v T) [16]byte
+}
+
+var ErrFingerprintSize = errors.New("filter does not take 128 bits fingerprints")
+
+// Typed is a filter of T values, fingerprints are computed by a Hasher so the filter hash is not used.
+type Typed[T any] struct {
+	filter Filter
+	hasher Hasher[T]
+}
+
+// NewTyped wrap filter to add and look up T values hashed by hasher.
+// The filter should take 128 bits fingerprints: double hashing or blocked filters of this package,
+// including counting, scalable, sparse, mapped, aging, stable and concurrent ones.
+func NewTyped[T any](filter Filter, hasher Hasher[T]) (*Typed[T], error) {
+	if !takeFingerprint128(filter) {
+		return nil, fmt.Errorf("%w: %T", ErrFingerprintSize, filter)
+	}
+
+	return &Typed[T]{
+		filter: filter,
+		hasher: hasher,
+	}, nil
+}
+
+// positionStrategy is implemented by the filters of the package, returning how they derive positions from fingerprints.
+type positionStrategy interface {
+	positionStrategy() strategy
+}
+
+// takeFingerprint128 return if filter derive its positions from the first 16 bytes of fingerprints.
+func takeFingerprint128(filter Filter) bool {
+	p, ok := filter.(positionStrategy)
+	if !ok {
+		return false
+	}
+	s := p.positionStrategy()
+	return s == strategyDoubleHashing || s == strategyBlocked
+}
+
+func (f *filter) positionStrategy() strategy { return f.strategy }
+
+func (f *countingFilter) positionStrategy() strategy { return f.strategy }
+
+func (f *stableFilter) positionStrategy() strategy { return f.strategy }
+
+func (f *sparseFilter) positionStrategy() strategy { return f.filter.strategy }
+
+func (f *scalableFilter) positionStrategy() strategy { return strategyDoubleHashing }
+
+func (f *agingFilter) positionStrategy() strategy { return strategyDoubleHashing }
+
+func (f *concurrentFilter) positionStrategy() strategy { return strategyDoubleHashing }
+
+// Add add v to the filter.
+func (t *Typed[T]) Add(v T) {
+	if f, ok := t.filter.(*filter); ok { // concrete call so the fingerprint stay on the stack
+		fp := t.hasher.Fingerprint(v)
+		f.AddFingerprint(fp[:])
+		return
+	}
+
+	fp := t.hasher.Fingerprint(v)
+	t.filter.AddFingerprint(fp[:])
+}
+
+// Contain return if v is probably in the filter.
+func (t *Typed[T]) Contain(v T) bool {
+	if f, ok := t.filter.(*filter); ok {
+		fp := t.hasher.Fingerprint(v)
+		return f.ContainFingerprint(fp[:])
+	}
+
+	fp := t.hasher.Fingerprint(v)
+	return t.filter.ContainFingerprint(fp[:])
+}
+
+// murmurFingerprint return the big endian representation of a murmur3 128 bits hash, as returned by its Sum.
+func murmurFingerprint(h1, h2 uint64) [16]byte {
+	var fp [16]byte
+	binary.BigEndian.PutUint64(fp[:8], h1)
+	binary.BigEndian.PutUint64(fp[8:], h2)
+	return fp
+}
+
+// StringHasher hash strings without copying them.
+type StringHasher struct{}
+
+func (StringHasher) Fingerprint(s string) [16]byte {
+	return murmurFingerprint(murmur3.StringSum128(s))
+}
+
+// BytesHasher hash byte slices.
+type BytesHasher struct{}
+
+func (BytesHasher) Fingerprint(b []byte) [16]byte {
+	return murmurFingerprint(murmur3.Sum128(b))
+}
+
+// Integer is the set of integer types.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// IntegerHasher hash integers as 64 bits, the same value has the same fingerprint whatever its type.
+type IntegerHasher[T Integer] struct{}
+
+func (IntegerHasher[T]) Fingerprint(v T) [16]byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	return murmurFingerprint(murmur3.Sum128(b[:]))
+}
+
+// StructHasher hash composite values, like (user, url) pairs, serialized field by field by an Encoder.
+type StructHasher[T any] struct {
+	encode func(e *Encoder, v T)
+}
+
+// NewStructHasher create a hasher of T values serialized by encode, for example:
+//
+//	NewStructHasher(func(e *Encoder, v visit) {
+//		e.String(v.UserID)
+//		e.String(v.URL)
+//	})
+func NewStructHasher[T any](encode func(e *Encoder, v T)) *StructHasher[T] {
+	return &StructHasher[T]{encode: encode}
+}
+
+var encoderPool = sync.Pool{
+	New: func() any { return &Encoder{} },
+}
+
+func (h *StructHasher[T]) Fingerprint(v T) [16]byte {
+	e := encoderPool.Get().(*Encoder)
+	e.buf = e.buf[:0]
+	h.encode(e, v)
+	fp := murmurFingerprint(murmur3.Sum128(e.buf))
+	encoderPool.Put(e)
+
+	return fp
+}
+
+// Encoder serialize the fields of a composite value in a reused buffer.
+// Variable length fields are prefixed by their length so ("ab", "c") and ("a", "bc") differ.
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) String(s string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *Encoder) Bytes(b []byte) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) Uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *Encoder) Int64(v int64) {
+	e.Uint64(uint64(v))
+}
+
+func (e *Encoder) Bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// AddString add s like Add([]byte(s)) without copying it with the default murmur3 hash.
+func (f *filter) AddString(s string) {
+	if f.murmur {
+		fp := StringHasher{}.Fingerprint(s)
+		f.AddFingerprint(fp[:])
+		return
+	}
+
+	h, hash := f.getHash()
+	io.WriteString(hash, s)
+	h.buf = hash.Sum(h.buf[:0])
+	hash.Reset()
+	f.releaseHash(h)
+
+	f.AddFingerprint(h.buf)
+	f.hashers.Put(h)
+}
+
+// ContainString return if s is probably in the filter like Contain([]byte(s)) without copying it with the default murmur3 hash.
+func (f *filter) ContainString(s string) bool {
+	if f.murmur {
+		fp := StringHasher{}.Fingerprint(s)
+		return f.ContainFingerprint(fp[:])
+	}
+
+	h, hash := f.getHash()
+	io.WriteString(hash, s)
+	h.buf = hash.Sum(h.buf[:0])
+	hash.Reset()
+	f.releaseHash(h)
+
+	contained := f.ContainFingerprint(h.buf)
+	f.hashers.Put(h)
+	return contained
+}
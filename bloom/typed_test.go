@@ -0,0 +1,228 @@
+package bloom_test
+
+import (
+	"bloom"
+	"crypto"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// visit is a (user, url) pair.
+type visit struct {
+	UserID string
+	URL    string
+}
+
+var visitHasher = bloom.NewStructHasher(func(e *bloom.Encoder, v visit) {
+	e.String(v.UserID)
+	e.String(v.URL)
+})
+
+// stringAdder is a bloom.Filter taking strings without copy.
+type stringAdder interface {
+	bloom.Filter
+	AddString(string)
+	ContainString(string) bool
+}
+
+func TestTypedFilter(t *testing.T) {
+	n := 10000
+
+	t.Run("string", func(t *testing.T) {
+		filter, err := bloom.NewDoubleHashing(uint64(n), 0.01)
+		require.NoError(t, err)
+		typed, err := bloom.NewTyped[string](filter, bloom.StringHasher{})
+		require.NoError(t, err)
+
+		for i := 0; i < n; i++ {
+			typed.Add(fmt.Sprintf("https://example.com/%d", i))
+		}
+		filter.Add([]byte("https://example.com/bytes"))
+
+		// same bits as the bytes API of a default filter
+		for i := 0; i < n; i++ {
+			require.True(t, filter.Contain([]byte(fmt.Sprintf("https://example.com/%d", i))), "false negative")
+		}
+		assert.True(t, typed.Contain("https://example.com/bytes"))
+	})
+
+	t.Run("integer", func(t *testing.T) {
+		filter, err := bloom.NewBlocked(uint64(n), 0.01)
+		require.NoError(t, err)
+		typed, err := bloom.NewTyped[int64](filter, bloom.IntegerHasher[int64]{})
+		require.NoError(t, err)
+
+		for i := 0; i < n; i++ {
+			typed.Add(int64(i))
+		}
+		for i := 0; i < n; i++ {
+			require.True(t, typed.Contain(int64(i)), "false negative")
+		}
+		// same fingerprint whatever the integer type
+		assert.Equal(t, bloom.IntegerHasher[int64]{}.Fingerprint(42), bloom.IntegerHasher[uint8]{}.Fingerprint(42))
+		assert.Equal(t, bloom.IntegerHasher[int64]{}.Fingerprint(-1), bloom.IntegerHasher[uint64]{}.Fingerprint(1<<64-1))
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		filter, err := bloom.NewCounting(uint64(n), 0.01) // not a *filter
+		require.NoError(t, err)
+		typed, err := bloom.NewTyped[visit](filter, visitHasher)
+		require.NoError(t, err)
+
+		for i := 0; i < n; i++ {
+			typed.Add(visit{UserID: fmt.Sprintf("u-%d", i%100), URL: fmt.Sprintf("https://example.com/%d", i)})
+		}
+		for i := 0; i < n; i++ {
+			require.True(t, typed.Contain(visit{UserID: fmt.Sprintf("u-%d", i%100), URL: fmt.Sprintf("https://example.com/%d", i)}), "false negative")
+		}
+
+		falsePositive := 0
+		for i := 0; i < n; i++ {
+			// same users and urls, other pairs
+			if typed.Contain(visit{UserID: fmt.Sprintf("u-%d", (i+1)%100), URL: fmt.Sprintf("https://example.com/%d", i)}) {
+				falsePositive++
+			}
+		}
+		assert.Less(t, float64(falsePositive)/float64(n), 0.01, "false positive rate")
+
+		// fields are delimited
+		assert.NotEqual(t, visitHasher.Fingerprint(visit{UserID: "ab", URL: "c"}), visitHasher.Fingerprint(visit{UserID: "a", URL: "bc"}))
+	})
+}
+
+func TestTypedFilterFingerprintSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		newFilter func() (bloom.Filter, error)
+		err       error
+	}{
+		{
+			name:      "double hashing",
+			newFilter: func() (bloom.Filter, error) { return bloom.NewDoubleHashing(1000, 0.01, crypto.SHA256.New()) },
+		},
+		{
+			name:      "sparse",
+			newFilter: func() (bloom.Filter, error) { return bloom.NewSparse(1000, 0.01) },
+		},
+		{
+			name:      "scalable",
+			newFilter: func() (bloom.Filter, error) { return bloom.NewScalable(1000, 0.01) },
+		},
+		{
+			name:      "chunk with more than 16 bytes of positions",
+			newFilter: func() (bloom.Filter, error) { return bloom.NewWithEstimates(1000, 0.001, crypto.SHA512.New()) },
+			err:       bloom.ErrFingerprintSize,
+		},
+		{
+			name:      "digest",
+			newFilter: func() (bloom.Filter, error) { return bloom.New(crypto.SHA256.New()) },
+			err:       bloom.ErrFingerprintSize,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.newFilter()
+			require.NoError(t, err)
+
+			typed, err := bloom.NewTyped[string](filter, bloom.StringHasher{})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			typed.Add("https://example.com/")
+			assert.True(t, typed.Contain("https://example.com/"))
+		})
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	tests := []struct {
+		name      string
+		newFilter func() (stringAdder, error)
+	}{
+		{
+			name: "Murmur3_128-DoubleHashing",
+			newFilter: func() (stringAdder, error) {
+				return bloom.NewDoubleHashing(1000, 0.01)
+			},
+		},
+		{
+			name: "MD5",
+			newFilter: func() (stringAdder, error) {
+				return bloom.New(crypto.MD5.New())
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.newFilter()
+			require.NoError(t, err)
+
+			filter.AddString("https://example.com/string")
+			filter.Add([]byte("https://example.com/bytes"))
+			assert.True(t, filter.Contain([]byte("https://example.com/string")))
+			assert.True(t, filter.ContainString("https://example.com/string"))
+			assert.True(t, filter.ContainString("https://example.com/bytes"))
+			assert.False(t, filter.ContainString("https://example.com/missing"))
+		})
+	}
+}
+
+func TestTypedFilterAllocs(t *testing.T) {
+	filter, err := bloom.NewDoubleHashing(1000, 0.01)
+	require.NoError(t, err)
+	typedString, err := bloom.NewTyped[string](filter, bloom.StringHasher{})
+	require.NoError(t, err)
+	typedInt, err := bloom.NewTyped[int](filter, bloom.IntegerHasher[int]{})
+	require.NoError(t, err)
+	typedVisit, err := bloom.NewTyped[visit](filter, visitHasher)
+	require.NoError(t, err)
+
+	url := "https://example.com/"
+	v := visit{UserID: "u-1", URL: url}
+	if raceEnabled {
+		t.Skip("sync.Pool allocate under the race detector")
+	}
+	assert.Zero(t, testing.AllocsPerRun(100, func() { filter.AddString(url) }), "AddString")
+	assert.Zero(t, testing.AllocsPerRun(100, func() { filter.ContainString(url) }), "ContainString")
+	assert.Zero(t, testing.AllocsPerRun(100, func() { typedString.Add(url) }), "Typed[string]")
+	assert.Zero(t, testing.AllocsPerRun(100, func() { typedInt.Add(42) }), "Typed[int]")
+	assert.Zero(t, testing.AllocsPerRun(100, func() { typedVisit.Add(v) }), "Typed[visit]")
+}
+
+func BenchmarkTypedFilter(b *testing.B) {
+	filter, err := bloom.NewDoubleHashing(1000000, 0.01)
+	require.NoError(b, err)
+	typed, err := bloom.NewTyped[string](filter, bloom.StringHasher{})
+	require.NoError(b, err)
+
+	urls := make([]string, 0, 1024)
+	for i := 0; i < cap(urls); i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	b.Run("Add-Bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			filter.Add([]byte(urls[i%len(urls)]))
+		}
+	})
+	b.Run("AddString", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			filter.AddString(urls[i%len(urls)])
+		}
+	})
+	b.Run("Typed-String", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			typed.Add(urls[i%len(urls)])
+		}
+	})
+}
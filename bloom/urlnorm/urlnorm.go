@@ -0,0 +1,281 @@
+package urlnorm
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidURL = errors.New("invalid url")
+
+// TrackingParams are common tracking query parameters, names ending with * are prefixes.
+var TrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"dclid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+}
+
+// defaultPorts are the ports stripped by scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// Rules select the normalizations applied, the zero Rules only drop empty query parameters and a trailing ?.
+type Rules struct {
+	// Lowercase lowercase the scheme and the host.
+	Lowercase bool
+	// StripDefaultPort remove the port when it is the default one of the scheme, like :443 for https.
+	StripDefaultPort bool
+	// StripFragment remove the #fragment.
+	StripFragment bool
+	// SortQuery sort query parameters by name, values of a repeated parameter keep their order.
+	SortQuery bool
+	// TrimTrailingSlash remove the slashes ending the path, the root path stay /.
+	TrimTrailingSlash bool
+	// Denylist are query parameters removed for every tenant, names ending with * are prefixes.
+	// Names are compared case insensitively.
+	Denylist []string
+}
+
+// DefaultRules apply every normalization and remove TrackingParams.
+var DefaultRules = Rules{
+	Lowercase:         true,
+	StripDefaultPort:  true,
+	StripFragment:     true,
+	SortQuery:         true,
+	TrimTrailingSlash: true,
+	Denylist:          TrackingParams,
+}
+
+// Normalizer canonicalize URLs before they are added to filters and sketches, so that URLs differing only
+// by case, default port, fragment, parameters order or tracking parameters are counted once.
+// It is safe for concurrent use.
+type Normalizer struct {
+	rules    Rules
+	denylist denylist
+
+	mu sync.RWMutex
+	// tenants are the denylists by tenant, added to the rules one.
+	tenants map[string]denylist
+}
+
+// New create a normalizer applying rules.
+func New(rules Rules) *Normalizer {
+	return &Normalizer{
+		rules:    rules,
+		denylist: newDenylist(rules.Denylist),
+		tenants:  map[string]denylist{},
+	}
+}
+
+// SetTenantDenylist replace the query parameters removed for the URLs of a tenant, on top of the rules denylist.
+// Without params the tenant only use the rules denylist.
+func (n *Normalizer) SetTenantDenylist(tenantID string, params ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(params) == 0 {
+		delete(n.tenants, tenantID)
+		return
+	}
+	n.tenants[tenantID] = newDenylist(params)
+}
+
+// tenantDenylist return the denylist of a tenant, empty if it has none.
+func (n *Normalizer) tenantDenylist(tenantID string) denylist {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.tenants[tenantID]
+}
+
+// URL return the canonical form of an absolute or relative URL, like the page url property.
+func (n *Normalizer) URL(tenantID, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	if n.rules.Lowercase {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+	}
+	if n.rules.StripDefaultPort {
+		u.Host = stripDefaultPort(u.Scheme, u.Host)
+	}
+	if n.rules.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if n.rules.TrimTrailingSlash {
+		path := trimTrailingSlash(u.EscapedPath())
+		if path == "" && u.Host != "" {
+			path = "/"
+		}
+		if u.Path, err = url.PathUnescape(path); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+		u.RawPath = path
+	}
+	u.RawQuery = n.query(tenantID, u.RawQuery)
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+
+	return u.String(), nil
+}
+
+// Path return the canonical form of a path, like the page path property.
+func (n *Normalizer) Path(path string) string {
+	if !n.rules.TrimTrailingSlash {
+		return path
+	}
+	if path = trimTrailingSlash(path); path == "" {
+		return "/"
+	}
+	return path
+}
+
+// Search return the canonical form of a query string starting with ?, like the page search property.
+// An empty query return an empty string.
+func (n *Normalizer) Search(tenantID, search string) string {
+	if query := n.query(tenantID, strings.TrimPrefix(search, "?")); query != "" {
+		return "?" + query
+	}
+	return ""
+}
+
+// Properties replace the url, path and search string properties of a page event by their canonical form.
+// Other properties are left unchanged.
+func (n *Normalizer) Properties(tenantID string, properties map[string]interface{}) error {
+	if u, ok := properties["url"].(string); ok {
+		normalized, err := n.URL(tenantID, u)
+		if err != nil {
+			return fmt.Errorf("url property: %w", err)
+		}
+		properties["url"] = normalized
+	}
+	if path, ok := properties["path"].(string); ok {
+		properties["path"] = n.Path(path)
+	}
+	if search, ok := properties["search"].(string); ok {
+		properties["search"] = n.Search(tenantID, search)
+	}
+
+	return nil
+}
+
+// query return the raw query without denied parameters, sorted if required.
+// Parameters are kept encoded as they are, only their decoded names are compared.
+func (n *Normalizer) query(tenantID, rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	tenant := n.tenantDenylist(tenantID)
+
+	type param struct {
+		name string
+		raw  string
+	}
+	params := make([]param, 0, strings.Count(rawQuery, "&")+1)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if n.denylist.match(name) || tenant.match(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+
+	if n.rules.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+
+	var b strings.Builder
+	for i, p := range params {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(p.raw)
+	}
+	return b.String()
+}
+
+// stripDefaultPort remove the default port of scheme from host, and an empty port.
+func stripDefaultPort(scheme, host string) string {
+	i := strings.LastIndexByte(host, ':')
+	if i < 0 || strings.LastIndexByte(host, ']') > i { // no port or an IPv6 address without port
+		return host
+	}
+	if port := host[i+1:]; port == "" || port == defaultPorts[strings.ToLower(scheme)] {
+		return host[:i]
+	}
+	return host
+}
+
+// trimTrailingSlash remove the slashes ending path, keeping the root /.
+func trimTrailingSlash(path string) string {
+	trimmed := strings.TrimRight(path, "/")
+	if trimmed == "" && path != "" {
+		return "/"
+	}
+	return trimmed
+}
+
+// denylist is a set of parameter names and name prefixes, lowercased.
+type denylist struct {
+	names    map[string]struct{}
+	prefixes []string
+}
+
+func newDenylist(params []string) denylist {
+	d := denylist{names: make(map[string]struct{}, len(params))}
+	for _, p := range params {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			d.prefixes = append(d.prefixes, prefix)
+		} else {
+			d.names[p] = struct{}{}
+		}
+	}
+	return d
+}
+
+// match return if the parameter name is denied.
+func (d denylist) match(name string) bool {
+	if len(d.names) == 0 && len(d.prefixes) == 0 {
+		return false
+	}
+
+	name = strings.ToLower(name)
+	if _, ok := d.names[name]; ok {
+		return true
+	}
+	for _, prefix := range d.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
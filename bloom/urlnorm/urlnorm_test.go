@@ -0,0 +1,171 @@
+package urlnorm_test
+
+import (
+	"bloom/urlnorm"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "tracking param",
+			url:  "https://Example.com/a?utm_source=x&b=1",
+			want: "https://example.com/a?b=1",
+		},
+		{
+			name: "scheme and host case",
+			url:  "HTTPS://WWW.Example.COM/Path",
+			want: "https://www.example.com/Path",
+		},
+		{
+			name: "default port",
+			url:  "https://example.com:443/a",
+			want: "https://example.com/a",
+		},
+		{
+			name: "http default port",
+			url:  "http://example.com:80/a",
+			want: "http://example.com/a",
+		},
+		{
+			name: "other port",
+			url:  "https://example.com:8443/a",
+			want: "https://example.com:8443/a",
+		},
+		{
+			name: "ipv6 port",
+			url:  "http://[::1]:80/a",
+			want: "http://[::1]/a",
+		},
+		{
+			name: "fragment",
+			url:  "https://example.com/a#section",
+			want: "https://example.com/a",
+		},
+		{
+			name: "sorted query",
+			url:  "https://example.com/a?c=3&a=1&b=2&a=0",
+			want: "https://example.com/a?a=1&a=0&b=2&c=3",
+		},
+		{
+			name: "encoding kept",
+			url:  "https://example.com/a%2Fb?q=a%20b&%75tm_medium=x",
+			want: "https://example.com/a%2Fb?q=a%20b",
+		},
+		{
+			name: "trailing slashes",
+			url:  "https://example.com/a/b//",
+			want: "https://example.com/a/b",
+		},
+		{
+			name: "root",
+			url:  "https://example.com",
+			want: "https://example.com/",
+		},
+		{
+			name: "empty query",
+			url:  "https://example.com/a?utm_source=x&&fbclid=y",
+			want: "https://example.com/a",
+		},
+		{
+			name: "relative",
+			url:  "/a/?b=1&utm_campaign=x",
+			want: "/a?b=1",
+		},
+	}
+	n := urlnorm.New(urlnorm.DefaultRules)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := n.URL("tenant", tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// canonical URLs are unchanged
+			again, err := n.URL("tenant", got)
+			require.NoError(t, err)
+			assert.Equal(t, got, again)
+		})
+	}
+
+	_, err := n.URL("tenant", "https://example.com/%zz")
+	assert.ErrorIs(t, err, urlnorm.ErrInvalidURL)
+}
+
+func TestRules(t *testing.T) {
+	raw := "HTTPS://Example.com:443/a/?b=1&utm_source=x&a=2#top"
+
+	n := urlnorm.New(urlnorm.Rules{})
+	got, err := n.URL("tenant", raw)
+	require.NoError(t, err)
+	assert.Equal(t, "https://Example.com:443/a/?b=1&utm_source=x&a=2#top", got)
+
+	n = urlnorm.New(urlnorm.Rules{StripFragment: true, SortQuery: true})
+	got, err = n.URL("tenant", raw)
+	require.NoError(t, err)
+	assert.Equal(t, "https://Example.com:443/a/?a=2&b=1&utm_source=x", got)
+
+	n = urlnorm.New(urlnorm.Rules{Denylist: []string{"B"}})
+	got, err = n.URL("tenant", raw)
+	require.NoError(t, err)
+	assert.Equal(t, "https://Example.com:443/a/?utm_source=x&a=2#top", got)
+}
+
+func TestTenantDenylist(t *testing.T) {
+	n := urlnorm.New(urlnorm.DefaultRules)
+	n.SetTenantDenylist("acme", "session", "ref_*")
+
+	raw := "https://example.com/a?session=1&ref_id=2&utm_source=x&q=3"
+	got, err := n.URL("acme", raw)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a?q=3", got)
+
+	got, err = n.URL("other", raw)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a?q=3&ref_id=2&session=1", got)
+
+	n.SetTenantDenylist("acme")
+	got, err = n.URL("acme", raw)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a?q=3&ref_id=2&session=1", got)
+}
+
+func TestProperties(t *testing.T) {
+	n := urlnorm.New(urlnorm.DefaultRules)
+
+	// properties of a page event
+	properties := map[string]interface{}{
+		"path":     "/toto/tata/",
+		"referrer": "https://Example.com/?utm_source=x",
+		"search":   "?to=2021-10-05&utm_medium=mail&from=2021-10-05",
+		"title":    "Cake | Acme",
+		"url":      "https://Example.com/toto/tata/?to=2021-10-05&utm_medium=mail&from=2021-10-05",
+		"keywords": []string{"cat"},
+	}
+	require.NoError(t, n.Properties("tenant", properties))
+	assert.Equal(t, map[string]interface{}{
+		"path":     "/toto/tata",
+		"referrer": "https://Example.com/?utm_source=x",
+		"search":   "?from=2021-10-05&to=2021-10-05",
+		"title":    "Cake | Acme",
+		"url":      "https://example.com/toto/tata?from=2021-10-05&to=2021-10-05",
+		"keywords": []string{"cat"},
+	}, properties)
+
+	for search, want := range map[string]string{"": "", "?": "", "?utm_source=x": "", "?b=1&a": "?a&b=1"} {
+		assert.Equal(t, want, n.Search("tenant", search), search)
+	}
+	for path, want := range map[string]string{"": "/", "/": "/", "//": "/", "/a//": "/a"} {
+		assert.Equal(t, want, n.Path(path), path)
+	}
+
+	properties = map[string]interface{}{"url": "http://[::1"}
+	assert.ErrorIs(t, n.Properties("tenant", properties), urlnorm.ErrInvalidURL)
+}